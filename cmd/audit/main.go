@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"unknownberrytrip/internal/blockchain"
+)
+
+// Audit a saved chain state: replay the fee and reward accounting of every block
+// and check that UNBT and token supplies are conserved. Exits 1 on violation.
+func main() {
+	statePath := flag.String("state", "chain_state.json", "Chain state file to audit")
+	flag.Parse()
+
+	bc, err := blockchain.LoadBlockchain(*statePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load state: %v\n", err)
+		os.Exit(2)
+	}
+
+	report := bc.AuditChain()
+	fmt.Printf("Audited %d blocks: minted %f UNBT, burned %f UNBT\n", report.Height, report.Minted, report.Burned)
+	for _, check := range report.Checks {
+		status := "ok"
+		if !check.OK() {
+			status = "MISMATCH"
+		}
+		fmt.Printf("  %-16s expected %f, actual %f  %s\n", check.Asset, check.Expected, check.Actual, status)
+	}
+	if !report.OK() {
+		fmt.Println("Violations:")
+		for _, violation := range report.Violations {
+			fmt.Printf("  %s\n", violation)
+		}
+		os.Exit(1)
+	}
+	fmt.Println("Supply conserved")
+}
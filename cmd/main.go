@@ -1,11 +1,17 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"os"
-	"unknownberrytrip/internal/api"
+	"os/signal"
+	"strings"
+	"syscall"
 	"unknownberrytrip/internal/blockchain"
+	"unknownberrytrip/internal/logging"
+	"unknownberrytrip/internal/node"
 	"unknownberrytrip/internal/wallet"
 )
 
@@ -16,33 +22,119 @@ type WalletData struct {
 }
 
 func main() {
-	// Create blockchain
-	bc := blockchain.NewBlockchain()
+	apiAddr := flag.String("api", ":8080", "API listen address")
+	statePath := flag.String("state", "chain_state.json", "File the chain state is loaded from and flushed to")
+	walletPath := flag.String("wallet", "miner_wallet.json", "File the miner wallet is written to")
+	poolAddr := flag.String("pool", "", "Mining pool listen address, e.g. :3333; empty disables the pool")
+	mine := flag.Bool("mine", true, "Mine blocks in-process; disable when external miners use /getBlockTemplate")
+	assertSupply := flag.Bool("assert-supply", false, "Audit supply after every block and stop the node on violation")
+	logLevel := flag.String("log-level", "info", "Default log level: debug, info, warn, error or off")
+	logLevels := flag.String("log-levels", "", "Per-component log levels, e.g. pool=debug,mining=warn")
+	logFormat := flag.String("log-format", "text", "Log output format: text or json")
+	wsOrigins := flag.String("ws-origins", "", "Comma-separated browser origins allowed to open /ws besides the API's own, or *")
+	controlToken := flag.String("control-token", os.Getenv("UNBT_CONTROL_TOKEN"), "Bearer token for mining and log control; empty allows loopback clients only")
+	flag.Parse()
 
-	// Create miner wallet
-	minerWallet := wallet.NewWallet()
-	bc.Balances[minerWallet.Address] = 100.0
-	bc.Nonces[minerWallet.Address] = 0
+	logger, err := newLogger(*logLevel, *logLevels, *logFormat)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid logging flags: %v\n", err)
+		os.Exit(1)
+	}
+
+	var bc *blockchain.Blockchain
+	var minerAddress string
+	if _, err := os.Stat(*statePath); err == nil {
+		// Resume the saved chain with the miner that created it
+		bc, err = blockchain.LoadBlockchain(*statePath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load state: %v\n", err)
+			os.Exit(1)
+		}
+		data, err := os.ReadFile(*walletPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read miner wallet: %v\n", err)
+			os.Exit(1)
+		}
+		var walletData WalletData
+		if err := json.Unmarshal(data, &walletData); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to decode miner wallet: %v\n", err)
+			os.Exit(1)
+		}
+		minerAddress = walletData.Address
+	} else {
+		// Create miner wallet and a blockchain funding it at genesis
+		minerWallet := wallet.NewWallet()
+		minerAddress = minerWallet.Address
+		params := blockchain.DefaultChainParams()
+		params.GenesisAlloc[minerAddress] = 100.0
+		params.GenesisTokens = map[string]map[string]float64{
+			"BERRY_TOKEN": {minerAddress: 1000.0},
+		}
+		bc = blockchain.NewBlockchainWithParams(params)
 
-	// Save miner data to temporary file
-	walletData := WalletData{
-		Address:    minerWallet.Address,
-		PrivateKey: fmt.Sprintf("%x", minerWallet.PrivateKey.D), // Private key in hex
-		PublicKey:  fmt.Sprintf("%x", minerWallet.PublicKey.X.Bytes()) + fmt.Sprintf("%x", minerWallet.PublicKey.Y.Bytes()),
+		// Save miner data to temporary file
+		walletData := WalletData{
+			Address:    minerWallet.Address,
+			PrivateKey: fmt.Sprintf("%x", minerWallet.PrivateKey.D), // Private key in hex
+			PublicKey:  fmt.Sprintf("%x", minerWallet.PublicKey.X.Bytes()) + fmt.Sprintf("%x", minerWallet.PublicKey.Y.Bytes()),
+		}
+		data, _ := json.Marshal(walletData)
+		os.WriteFile(*walletPath, data, 0644)
 	}
-	data, _ := json.Marshal(walletData)
-	os.WriteFile("miner_wallet.json", data, 0644)
 
-	// Start API
-	api.StartAPI(bc)
+	// Stop on SIGINT/SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	// Start mining
-	bc.StartMining(minerWallet.Address)
+	// Start API and mining
+	cfg := node.Config{
+		APIAddr:      *apiAddr,
+		MinerAddress: minerAddress,
+		StatePath:    *statePath,
+		PoolAddr:     *poolAddr,
+		PoolOperator: minerAddress,
+		AssertSupply: *assertSupply,
+		Logger:       logger,
+		ControlToken: *controlToken,
+	}
+	if *wsOrigins != "" {
+		cfg.AllowedOrigins = strings.Split(*wsOrigins, ",")
+	}
+	if !*mine {
+		cfg.MinerAddress = ""
+	}
+	n := node.New(bc, cfg)
+	if err := n.Start(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to start node: %v\n", err)
+		os.Exit(1)
+	}
 
 	// Output initial state
-	fmt.Printf("Blockchain started. Miner address: %s\n", minerWallet.Address)
-	fmt.Println("API available at :8080/sendTransaction")
+	logger.Component("node").Info("Blockchain started", "miner", minerAddress, "api", n.APIAddr(), "rpc", "/rpc", "ws", "/ws", "metrics", "/metrics")
 
-	// Block main thread
-	select {}
+	// Block until a signal arrives or the chain halts, then shut down cleanly
+	select {
+	case <-ctx.Done():
+	case <-bc.Halted():
+	}
+	if err := n.Stop(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to stop node cleanly: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// newLogger builds the root logger from the logging flags
+func newLogger(level, levels, format string) (*logging.Logger, error) {
+	opts := logging.Options{}
+	var err error
+	if opts.Level, err = logging.ParseLevel(level); err != nil {
+		return nil, err
+	}
+	if opts.Levels, err = logging.ParseLevels(levels); err != nil {
+		return nil, err
+	}
+	if opts.Format, err = logging.ParseFormat(format); err != nil {
+		return nil, err
+	}
+	return logging.New(os.Stdout, opts), nil
 }
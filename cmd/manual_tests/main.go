@@ -4,8 +4,6 @@ import (
 	"bytes"
 	"crypto/ecdsa"
 	"crypto/elliptic"
-	"crypto/rand"
-	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
@@ -65,23 +63,7 @@ func main() {
 	}
 
 	// Sign transaction
-	txForSign := struct {
-		From            string
-		To              string
-		Amount          float64
-		Nonce           int
-		ExtraPower      int
-		IsTokenTransfer bool
-		TokenID         string
-	}{tx1.From, tx1.To, tx1.Amount, tx1.Nonce, tx1.ExtraPower, tx1.IsTokenTransfer, tx1.TokenID}
-	dataForSign, _ := json.Marshal(txForSign)
-	hash := sha256.Sum256(dataForSign)
-	r, s, err := ecdsa.Sign(rand.Reader, senderWallet.PrivateKey, hash[:])
-	if err != nil {
-		panic("Failed to sign transaction: " + err.Error())
-	}
-	signature := append(r.Bytes(), s.Bytes()...)
-	tx1.Signature = hex.EncodeToString(signature)
+	tx1.Signature = senderWallet.SignTx(&tx1)
 
 	// Token transaction
 	tx2 := transaction.Transaction{
@@ -96,23 +78,7 @@ func main() {
 	}
 
 	// Sign second transaction
-	txForSign2 := struct {
-		From            string
-		To              string
-		Amount          float64
-		Nonce           int
-		ExtraPower      int
-		IsTokenTransfer bool
-		TokenID         string
-	}{tx2.From, tx2.To, tx2.Amount, tx2.Nonce, tx2.ExtraPower, tx2.IsTokenTransfer, tx2.TokenID}
-	dataForSign2, _ := json.Marshal(txForSign2)
-	hash2 := sha256.Sum256(dataForSign2)
-	r2, s2, err := ecdsa.Sign(rand.Reader, senderWallet.PrivateKey, hash2[:])
-	if err != nil {
-		panic("Failed to sign transaction: " + err.Error())
-	}
-	signature2 := append(r2.Bytes(), s2.Bytes()...)
-	tx2.Signature = hex.EncodeToString(signature2)
+	tx2.Signature = senderWallet.SignTx(&tx2)
 
 	// Send transactions
 	txs := []transaction.Transaction{tx1, tx2}
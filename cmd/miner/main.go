@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+	"unknownberrytrip/internal/api"
+	"unknownberrytrip/internal/blockchain"
+	"unknownberrytrip/internal/pool"
+)
+
+// Standalone miner: fetches block templates from a node, solves them and submits the
+// nonce, or mines shares for a pool with -pool
+func main() {
+	nodeURL := flag.String("node", "http://localhost:8080", "Node API base URL")
+	minerAddress := flag.String("address", "", "Address receiving the block reward")
+	workers := flag.Int("workers", 0, "Mining goroutines, 0 for one per CPU")
+	refresh := flag.Duration("refresh", 10*time.Second, "How often to fetch fresh work")
+	poolAddr := flag.String("pool", "", "Mine for a pool at this TCP address instead of solo against -node")
+	flag.Parse()
+	if *minerAddress == "" {
+		fmt.Fprintln(os.Stderr, "-address is required")
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	miner := blockchain.NewMiner(*workers)
+	if *poolAddr != "" {
+		if err := minePool(ctx, *poolAddr, *minerAddress, miner); err != nil && ctx.Err() == nil {
+			fmt.Fprintf(os.Stderr, "Pool mining failed: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	for ctx.Err() == nil {
+		tmpl, err := getTemplate(*nodeURL, *minerAddress)
+		if err != nil {
+			fmt.Printf("[Miner] Failed to get template: %v\n", err)
+			sleep(ctx, *refresh)
+			continue
+		}
+		if len(tmpl.Transactions) == 0 {
+			fmt.Println("[Miner] No transactions to mine")
+			sleep(ctx, *refresh)
+			continue
+		}
+		prefix, err := hex.DecodeString(tmpl.HeaderPrefix)
+		if err != nil {
+			fmt.Printf("[Miner] Invalid header prefix: %v\n", err)
+			sleep(ctx, *refresh)
+			continue
+		}
+
+		// Give up on the template after the refresh period, the tip may have moved
+		workCtx, cancel := context.WithTimeout(ctx, *refresh)
+		nonce, hash, err := miner.MineHeader(workCtx, prefix, tmpl.Difficulty)
+		cancel()
+		if err != nil {
+			continue
+		}
+		fmt.Printf("[Miner] Solved block #%d: nonce %d, hash %x, %.0f H/s\n", tmpl.Index, nonce, hash, miner.Hashrate())
+		if err := submit(*nodeURL, tmpl.ID, int(nonce)); err != nil {
+			fmt.Printf("[Miner] Submission rejected: %v\n", err)
+		}
+	}
+}
+
+func getTemplate(nodeURL, minerAddress string) (*blockchain.BlockTemplate, error) {
+	resp, err := http.Get(nodeURL + "/getBlockTemplate?miner=" + url.QueryEscape(minerAddress))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	var tmpl blockchain.BlockTemplate
+	if err := json.NewDecoder(resp.Body).Decode(&tmpl); err != nil {
+		return nil, err
+	}
+	return &tmpl, nil
+}
+
+func submit(nodeURL, templateID string, nonce int) error {
+	body, _ := json.Marshal(api.SubmitBlockRequest{TemplateID: templateID, Nonce: nonce})
+	resp, err := http.Post(nodeURL+"/submitBlock", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
+
+// minePool logs in to a pool and submits shares for the latest job until ctx is done
+func minePool(ctx context.Context, poolAddr, minerAddress string, miner *blockchain.Miner) error {
+	conn, err := net.Dial("tcp", poolAddr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	var writeMu sync.Mutex
+	enc := json.NewEncoder(conn)
+	nextID := 0
+	send := func(method string, params interface{}) error {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		raw, _ := json.Marshal(params)
+		nextID++
+		return enc.Encode(pool.Request{ID: nextID, Method: method, Params: raw})
+	}
+	if err := send("login", pool.LoginParams{Address: minerAddress}); err != nil {
+		return err
+	}
+
+	cancelWork := func() {}
+	defer func() { cancelWork() }()
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		var msg pool.Message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			return fmt.Errorf("invalid message from pool: %w", err)
+		}
+		switch {
+		case msg.Method == "job":
+			cancelWork()
+			workCtx, cancel := context.WithCancel(ctx)
+			cancelWork = cancel
+			go workJob(workCtx, miner, msg.Params, send)
+		case msg.Error != "":
+			fmt.Printf("[Miner] Pool rejected request %d: %s\n", msg.ID, msg.Error)
+		case msg.Result != nil && msg.Result.Block:
+			fmt.Printf("[Miner] Share %d solved a block\n", msg.ID)
+		}
+	}
+	return scanner.Err()
+}
+
+// workJob searches the job's nonce range for shares until workCtx is done
+func workJob(workCtx context.Context, miner *blockchain.Miner, job pool.Job, send func(string, interface{}) error) {
+	prefix, err := hex.DecodeString(job.HeaderPrefix)
+	if err != nil {
+		fmt.Printf("[Miner] Invalid header prefix in job %s\n", job.JobID)
+		return
+	}
+	fmt.Printf("[Miner] New job %s for block #%d at share difficulty %.2f\n", job.JobID, job.Height, job.Difficulty)
+	for nonce := job.NonceStart; nonce < job.NonceEnd; nonce++ {
+		found, _, err := miner.Search(workCtx, prefix, nonce, func(hash [32]byte) bool {
+			return pool.HashValue(hash) < job.ShareTarget
+		})
+		if err != nil {
+			return
+		}
+		if err := send("submit", pool.SubmitParams{JobID: job.JobID, Nonce: found}); err != nil {
+			return
+		}
+		nonce = found
+	}
+}
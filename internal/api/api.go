@@ -1,29 +1,133 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"net"
 	"net/http"
+	"sync"
 	"unknownberrytrip/internal/blockchain"
-	"unknownberrytrip/internal/transaction"
+	"unknownberrytrip/internal/logging"
+	"unknownberrytrip/internal/metrics"
 )
 
-// StartAPI starts the HTTP server for interacting with the blockchain
-func StartAPI(bc *blockchain.Blockchain) {
-	http.HandleFunc("/sendTransaction", func(w http.ResponseWriter, r *http.Request) {
-		var tx transaction.Transaction
-		if err := json.NewDecoder(r.Body).Decode(&tx); err != nil {
-			http.Error(w, "Invalid request", http.StatusBadRequest)
-			return
-		}
-
-		if err := bc.AddTransactionToPool(tx); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("Transaction added to pool"))
-	})
-
-	go http.ListenAndServe(":8080", nil)
+// Server is the HTTP server for interacting with the blockchain. Every method of
+// its registry is served over JSON-RPC at /rpc and, when it has a route, over REST.
+type Server struct {
+	bc            *blockchain.Blockchain
+	miner         MiningControl
+	health        HealthOptions
+	control       ControlOptions
+	log           *logging.Logger
+	metrics       *metrics.Registry
+	apiMetrics    apiMetrics
+	stopMetrics   func() // Stops following chain events for metrics
+	registry      []method
+	methodsByName map[string]method
+	srv           *http.Server
+	listener      net.Listener
+	connMu        sync.Mutex
+	wsConns       map[*wsConn]struct{} // Hijacked WebSocket connections, closed on Shutdown
+	shutdown      bool
+}
+
+// NewServer creates an API server for bc listening on addr
+func NewServer(bc *blockchain.Blockchain, addr string) *Server {
+	s := &Server{bc: bc, log: logging.Default().Component("api"), wsConns: make(map[*wsConn]struct{})}
+	s.metrics = metrics.NewRegistry()
+	s.apiMetrics = newAPIMetrics(s.metrics)
+	s.stopMetrics = metrics.RegisterChain(s.metrics, bc)
+	s.registry = s.methods()
+	s.methodsByName = make(map[string]method, len(s.registry))
+	for _, m := range s.registry {
+		s.methodsByName[m.name] = m
+	}
+	s.srv = &http.Server{Addr: addr, Handler: s.Handler()}
+	return s
+}
+
+// SetMiningControl enables the mining_* methods; call it before Start
+func (s *Server) SetMiningControl(m MiningControl) {
+	s.miner = m
+}
+
+// SetLogger sets the root logger; requests are logged under the api component and
+// the log_* methods change the levels of every logger sharing its root
+func (s *Server) SetLogger(l *logging.Logger) {
+	s.log = l.Component("api")
+}
+
+// Metrics returns the registry served at /metrics, for other components to add to
+func (s *Server) Metrics() *metrics.Registry {
+	return s.metrics
+}
+
+// Handler returns the HTTP handler serving the API
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rpc", s.handleRPC)
+	mux.HandleFunc("/ws", s.handleWebSocket)
+	mux.Handle("/metrics", s.metrics.Handler())
+	mux.HandleFunc("/healthz", s.handleHealthz)
+	mux.HandleFunc("/readyz", s.handleReadyz)
+	mux.HandleFunc("/", s.serveREST)
+	return s.instrument(s.withAccess(mux))
+}
+
+// Start binds the listening address and serves requests in the background.
+// Bind errors are returned instead of being lost in the serving goroutine.
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.srv.Addr)
+	if err != nil {
+		return err
+	}
+	s.listener = listener
+	go s.srv.Serve(listener)
+	return nil
+}
+
+// Addr returns the bound address, useful when listening on port 0
+func (s *Server) Addr() string {
+	if s.listener == nil {
+		return s.srv.Addr
+	}
+	return s.listener.Addr().String()
+}
+
+// Shutdown stops accepting connections, closes WebSocket sessions and waits for
+// active requests until ctx is done
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.connMu.Lock()
+	s.shutdown = true
+	for conn := range s.wsConns {
+		conn.Close()
+	}
+	s.connMu.Unlock()
+	s.stopMetrics()
+	return s.srv.Shutdown(ctx)
+}
+
+// trackConn registers a WebSocket connection to close on Shutdown; it returns
+// false when the server is already shutting down
+func (s *Server) trackConn(conn *wsConn) bool {
+	s.connMu.Lock()
+	defer s.connMu.Unlock()
+	if s.shutdown {
+		return false
+	}
+	s.wsConns[conn] = struct{}{}
+	return true
+}
+
+func (s *Server) untrackConn(conn *wsConn) {
+	s.connMu.Lock()
+	defer s.connMu.Unlock()
+	delete(s.wsConns, conn)
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
 }
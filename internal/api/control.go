@@ -0,0 +1,101 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ControlOptions configure who may call the control methods, which change how
+// the node runs rather than reading or submitting to the chain
+type ControlOptions struct {
+	Token        string // Bearer token required for control; empty allows loopback clients only
+	MinerAddress string // Address loopback clients may start mining to without the token
+	// Origins besides the node's own that browsers may open /ws from, such as
+	// "https://explorer.example"; "*" allows any
+	AllowedOrigins []string
+}
+
+// access is what a caller may do with the control methods
+type access int
+
+const (
+	accessNone  access = iota
+	accessLocal        // Loopback client while no token is configured, limited to the configured miner
+	accessToken        // Presented the control token
+)
+
+type accessKey struct{}
+
+// SetControlOptions configures the control methods; call it before Start
+func (s *Server) SetControlOptions(opts ControlOptions) {
+	s.control = opts
+}
+
+// withAccess attaches the control access of the request to its context
+func (s *Server) withAccess(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), accessKey{}, s.access(r))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// access checks the Authorization header, or the client address when no token is set
+func (s *Server) access(r *http.Request) access {
+	if s.control.Token != "" {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if ok && subtle.ConstantTimeCompare([]byte(token), []byte(s.control.Token)) == 1 {
+			return accessToken
+		}
+		return accessNone
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return accessNone
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return accessLocal
+	}
+	return accessNone
+}
+
+// accessFrom returns the control access attached to ctx, none when there is none
+func accessFrom(ctx context.Context) access {
+	a, _ := ctx.Value(accessKey{}).(access)
+	return a
+}
+
+// requireControl fails unless the caller may use the control methods
+func requireControl(ctx context.Context) error {
+	if accessFrom(ctx) == accessNone {
+		return forbidden("control methods require the control token or a loopback client")
+	}
+	return nil
+}
+
+// isJSON reports whether the request body is declared as JSON. Requiring it on
+// POSTs keeps browsers from sending them cross-site without a CORS preflight.
+func isJSON(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/json"
+}
+
+// originAllowed reports whether a WebSocket handshake may proceed. Requests
+// without Origin come from programs rather than browsers and are allowed.
+func (s *Server) originAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	for _, allowed := range s.control.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(strings.TrimRight(allowed, "/"), origin) {
+			return true
+		}
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
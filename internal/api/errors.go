@@ -0,0 +1,111 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"unknownberrytrip/internal/blockchain"
+)
+
+// Error codes of failures outside the chain; chain rejections use the codes of
+// blockchain.ErrorCode, such as NONCE_TOO_LOW or INSUFFICIENT_BALANCE
+const (
+	ErrCodeInvalidRequest   = "INVALID_REQUEST"    // Body is not valid JSON
+	ErrCodeInvalidParams    = "INVALID_PARAMS"     // Params of the wrong type or out of range
+	ErrCodeNotFound         = "NOT_FOUND"          // Route, block, transaction or account does not exist
+	ErrCodeMethodNotAllowed = "METHOD_NOT_ALLOWED" // Route exists for other HTTP methods
+	ErrCodeRejected         = "REJECTED"           // Refused for a reason without its own code
+	ErrCodeUnavailable      = "UNAVAILABLE"        // Feature not enabled on this node
+	ErrCodeForbidden        = "FORBIDDEN"          // Control method called without the control token
+	ErrCodeUnsupportedMedia = "UNSUPPORTED_MEDIA"  // POST body not declared as application/json
+	ErrCodeInternal         = "INTERNAL"
+)
+
+// ErrorResponse is the body of every failed REST call
+type ErrorResponse struct {
+	Error ErrorBody `json:"error"`
+}
+
+// ErrorBody describes a failure. Code is stable and meant for programs, Message
+// for people; Details holds the values behind it, like the expected nonce.
+type ErrorBody struct {
+	Code    string                 `json:"code"`
+	Message string                 `json:"message"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// ErrorData is the data member of JSON-RPC errors returned by methods
+type ErrorData struct {
+	Code    string                 `json:"code"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// methodError is a failed call, with its REST status, JSON-RPC code and API code
+type methodError struct {
+	status  int
+	code    int
+	apiCode string
+	message string
+	details map[string]interface{}
+}
+
+func (e *methodError) Error() string { return e.message }
+
+func invalidParams(msg string) error {
+	return &methodError{status: http.StatusBadRequest, code: codeInvalidParams, apiCode: ErrCodeInvalidParams, message: msg}
+}
+
+func notFound(msg string) error {
+	return &methodError{status: http.StatusNotFound, code: codeNotFound, apiCode: ErrCodeNotFound, message: msg}
+}
+
+func rejected(msg string) error {
+	return &methodError{status: http.StatusBadRequest, code: codeRejected, apiCode: ErrCodeRejected, message: msg}
+}
+
+func unavailable(msg string) error {
+	return &methodError{status: http.StatusServiceUnavailable, code: codeUnavailable, apiCode: ErrCodeUnavailable, message: msg}
+}
+
+func forbidden(msg string) error {
+	return &methodError{status: http.StatusForbidden, code: codeForbidden, apiCode: ErrCodeForbidden, message: msg}
+}
+
+// chainError reports a transaction or block refused by the chain under the code
+// of the sentinel it wraps
+func chainError(err error) error {
+	merr := &methodError{status: http.StatusBadRequest, code: codeRejected, apiCode: blockchain.ErrorCode(err), message: err.Error(), details: blockchain.ErrorDetails(err)}
+	if merr.apiCode == "" {
+		merr.apiCode = ErrCodeRejected
+	}
+	if errors.Is(err, blockchain.ErrHalted) {
+		merr.status = http.StatusServiceUnavailable
+		merr.code = codeUnavailable
+	}
+	return merr
+}
+
+// asMethodError returns err as a *methodError, an internal error if it is not one
+func asMethodError(err error) *methodError {
+	var merr *methodError
+	if errors.As(err, &merr) {
+		return merr
+	}
+	return &methodError{status: http.StatusInternalServerError, code: codeInternalError, apiCode: ErrCodeInternal, message: err.Error()}
+}
+
+// rpcError converts err to the error member of a JSON-RPC response
+func rpcError(err error) *RPCError {
+	merr := asMethodError(err)
+	return &RPCError{Code: merr.code, Message: merr.message, Data: &ErrorData{Code: merr.apiCode, Details: merr.details}}
+}
+
+// writeError writes the JSON error envelope
+func writeError(w http.ResponseWriter, status int, code, message string, details map[string]interface{}) {
+	writeJSON(w, status, ErrorResponse{Error: ErrorBody{Code: code, Message: message, Details: details}})
+}
+
+// writeMethodError writes the envelope of a failed call
+func writeMethodError(w http.ResponseWriter, err error) {
+	merr := asMethodError(err)
+	writeError(w, merr.status, merr.apiCode, merr.message, merr.details)
+}
@@ -0,0 +1,172 @@
+package api
+
+import (
+	"net/http"
+	"time"
+)
+
+// Health statuses of checks and reports
+const (
+	HealthOK       = "ok"
+	HealthDegraded = "degraded"
+)
+
+// HealthOptions configure the health checks
+type HealthOptions struct {
+	MaxTipAge    time.Duration // Tip age after which a node with pooled transactions counts as stalled
+	PoolCapacity int           // Pool size counted as saturated, 0 for 10 blocks' worth
+	Storage      func() error  // Checks that state can be persisted, nil when there is no storage
+}
+
+// DefaultMaxTipAge is the tip age past which a node with waiting transactions is stalled
+const DefaultMaxTipAge = 10 * time.Minute
+
+// HealthReport is returned by /healthz and /readyz
+type HealthReport struct {
+	Status  string        // ok or degraded
+	Checks  []HealthCheck // Every check with its own status
+	Tip     TipHealth
+	Sync    SyncHealth
+	Mempool MempoolHealth
+	Storage StorageHealth
+	Mining  MiningStatus
+}
+
+// HealthCheck is the outcome of one check
+type HealthCheck struct {
+	Name   string
+	Status string
+	Detail string `json:",omitempty"`
+}
+
+// TipHealth describes the chain tip
+type TipHealth struct {
+	Height     int
+	Hash       string
+	AgeSeconds int64
+	Halted     bool
+}
+
+// SyncHealth compares the node to its peers. Nodes do not peer yet, so every node
+// is standalone and in sync with itself.
+type SyncHealth struct {
+	Mode     string // standalone
+	Peers    int
+	Syncing  bool
+	PeerTip  int // Highest tip among peers, the own tip when standalone
+	BehindBy int
+}
+
+// MempoolHealth describes how full the pool is
+type MempoolHealth struct {
+	Size       int
+	Capacity   int
+	Saturation float64 // Size / Capacity
+}
+
+// StorageHealth reports whether state can be persisted
+type StorageHealth struct {
+	Enabled bool
+	Error   string `json:",omitempty"`
+}
+
+// SetHealthOptions configures the health checks; call it before Start
+func (s *Server) SetHealthOptions(opts HealthOptions) {
+	s.health = opts
+}
+
+// Health runs every check. Liveness only fails when the chain halted or the miner
+// loop died, conditions a restart may fix; readiness fails on any degraded check.
+func (s *Server) Health() (report HealthReport, live bool) {
+	head := s.bc.Head()
+	now := time.Now()
+	report.Tip = TipHealth{
+		Height:     head.Height,
+		Hash:       head.Hash,
+		AgeSeconds: now.Unix() - head.Timestamp,
+		Halted:     s.bc.HaltError() != nil,
+	}
+	report.Sync = SyncHealth{Mode: "standalone", PeerTip: head.Height}
+	capacity := s.health.PoolCapacity
+	if capacity <= 0 {
+		capacity = 10 * s.bc.Params.MaxBlockTxs
+		if capacity <= 0 {
+			capacity = 10000
+		}
+	}
+	report.Mempool = MempoolHealth{Size: head.PoolSize, Capacity: capacity, Saturation: float64(head.PoolSize) / float64(capacity)}
+	if s.miner != nil {
+		report.Mining = s.miner.MiningStatus()
+	} else {
+		report.Mining = MiningStatus{Hashrate: s.bc.Hashrate()}
+	}
+
+	live = true
+	add := func(name string, ok bool, detail string) {
+		check := HealthCheck{Name: name, Status: HealthOK}
+		if !ok {
+			check.Status = HealthDegraded
+			check.Detail = detail
+		}
+		report.Checks = append(report.Checks, check)
+	}
+
+	var haltDetail string
+	if err := s.bc.HaltError(); err != nil {
+		haltDetail = err.Error()
+		live = false
+	}
+	add("chain", haltDetail == "", haltDetail)
+
+	maxAge := s.health.MaxTipAge
+	if maxAge <= 0 {
+		maxAge = DefaultMaxTipAge
+	}
+	// An idle chain mines no blocks, so an old tip only matters with work waiting
+	stalled := head.PoolSize > 0 && time.Duration(report.Tip.AgeSeconds)*time.Second > maxAge
+	add("tip", !stalled, "no block for "+(time.Duration(report.Tip.AgeSeconds)*time.Second).String()+" with transactions waiting")
+
+	add("sync", !report.Sync.Syncing, "catching up with peers")
+	add("mempool", report.Mempool.Saturation < 1, "pool is full")
+
+	if s.health.Storage != nil {
+		report.Storage.Enabled = true
+		if err := s.health.Storage(); err != nil {
+			report.Storage.Error = err.Error()
+		}
+	}
+	add("storage", report.Storage.Error == "", report.Storage.Error)
+
+	add("mining", !report.Mining.Failed, "mining loop exited unexpectedly")
+	if report.Mining.Failed {
+		live = false
+	}
+
+	report.Status = HealthOK
+	for _, check := range report.Checks {
+		if check.Status != HealthOK {
+			report.Status = HealthDegraded
+		}
+	}
+	return report, live
+}
+
+// handleHealthz reports liveness: 503 when the node needs a restart
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	report, live := s.Health()
+	status := http.StatusOK
+	if !live {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, report)
+}
+
+// handleReadyz reports readiness: 503 when any check is degraded
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	report, _ := s.Health()
+	status := http.StatusOK
+	if report.Status != HealthOK {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, report)
+}
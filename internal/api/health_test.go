@@ -0,0 +1,68 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"unknownberrytrip/internal/blockchain"
+	"unknownberrytrip/internal/wallet"
+)
+
+// getHealth fetches a health endpoint and decodes the report
+func getHealth(t *testing.T, url string) (int, HealthReport) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s failed: %v", url, err)
+	}
+	defer resp.Body.Close()
+	var report HealthReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		t.Fatalf("Decoding report failed: %v", err)
+	}
+	return resp.StatusCode, report
+}
+
+func TestHealthAndReadiness(t *testing.T) {
+	senderWallet := wallet.NewWallet()
+	params := blockchain.DefaultChainParams()
+	params.GenesisAlloc[senderWallet.Address] = 10.0
+	bc := blockchain.NewBlockchainWithParams(params)
+	s := NewServer(bc, "")
+	var storageErr error
+	s.SetHealthOptions(HealthOptions{PoolCapacity: 2, Storage: func() error { return storageErr }})
+	srv := httptest.NewServer(s.Handler())
+	defer srv.Close()
+
+	status, report := getHealth(t, srv.URL+"/readyz")
+	if status != http.StatusOK || report.Status != HealthOK || report.Sync.Mode != "standalone" || !report.Storage.Enabled {
+		t.Fatalf("Expected a ready standalone node, got %d %+v", status, report)
+	}
+
+	for nonce := 0; nonce < 2; nonce++ {
+		if err := bc.AddTransactionToPool(*senderWallet.CreateTransaction("receiver", 1.0, nonce)); err != nil {
+			t.Fatalf("AddTransactionToPool failed: %v", err)
+		}
+	}
+	storageErr = errors.New("disk full")
+	status, report = getHealth(t, srv.URL+"/readyz")
+	if status != http.StatusServiceUnavailable || report.Status != HealthDegraded || report.Mempool.Saturation != 1 {
+		t.Fatalf("Expected a saturated pool to make the node unready, got %d %+v", status, report)
+	}
+	degraded := map[string]bool{}
+	for _, check := range report.Checks {
+		if check.Status != HealthOK {
+			degraded[check.Name] = true
+		}
+	}
+	if len(degraded) != 2 || !degraded["mempool"] || !degraded["storage"] {
+		t.Errorf("Expected mempool and storage degraded, got %+v", report.Checks)
+	}
+
+	// Liveness ignores conditions a restart would not fix
+	if status, _ := getHealth(t, srv.URL+"/healthz"); status != http.StatusOK {
+		t.Errorf("Expected the node to stay live, got %d", status)
+	}
+}
@@ -0,0 +1,382 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"unknownberrytrip/internal/blockchain"
+	"unknownberrytrip/internal/logging"
+	"unknownberrytrip/internal/transaction"
+)
+
+// MiningStatus reports whether the node mines and how fast
+type MiningStatus struct {
+	Running  bool
+	Failed   bool    // The mining loop exited while it should be running
+	Address  string  // Address receiving the rewards
+	Hashrate float64 // Hashes per second of the last mining run
+}
+
+// MiningControl starts and stops the miner of a node
+type MiningControl interface {
+	StartMining(address string) error
+	StopMining() error
+	MiningStatus() MiningStatus
+}
+
+// method is an API operation. Every method is served over JSON-RPC under name and,
+// when path is set, over REST as verb path. Path segments written {field} bind to
+// the params field of that JSON name, as do query parameters and, for POST, the body.
+type method struct {
+	name   string
+	verb   string
+	path   string
+	params func() interface{} // Returns a pointer to a new params value, nil when there are none
+	call   func(ctx context.Context, params interface{}) (interface{}, error)
+}
+
+// BlockRef selects a block by height or hash; JSON numbers and strings are accepted
+type BlockRef string
+
+// UnmarshalJSON accepts a height as a number or a height or hash as a string
+func (b *BlockRef) UnmarshalJSON(data []byte) error {
+	var n int
+	if err := json.Unmarshal(data, &n); err == nil {
+		*b = BlockRef(strconv.Itoa(n))
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("block reference must be a height or a hash")
+	}
+	*b = BlockRef(s)
+	return nil
+}
+
+// Params of the API methods
+type (
+	BlockParams struct {
+		Ref BlockRef `json:"ref"` // Height or hash
+	}
+	BlocksParams struct {
+		Before int `json:"before"`
+		Limit  int `json:"limit"`
+	}
+	TxParams struct {
+		ID string `json:"id"`
+	}
+	AddressParams struct {
+		Address string `json:"address"`
+	}
+	MempoolParams struct {
+		Offset int `json:"offset"`
+		Limit  int `json:"limit"`
+	}
+	EstimateFeeParams struct {
+		Blocks     int     `json:"blocks"`
+		Confidence float64 `json:"confidence"`
+		From       string  `json:"from"`
+		Token      bool    `json:"token"`
+	}
+	BlockTemplateParams struct {
+		Miner string `json:"miner"`
+	}
+	MiningStartParams struct {
+		Address string `json:"address"` // Empty for the node's configured miner
+	}
+	LogLevelParams struct {
+		Component string `json:"component"` // Empty for the default level
+		Level     string `json:"level"`     // debug, info, warn, error or off; empty to follow the default
+	}
+	SimulateParams struct {
+		transaction.Transaction
+		Unsigned bool `json:"unsigned"` // Skip the signature check to price a transaction before signing
+	}
+)
+
+// LogLevels are the default log level and the levels set per component
+type LogLevels struct {
+	Default    logging.Level
+	Components map[string]logging.Level
+}
+
+// SubmitBlockRequest is the body of /submitBlock
+type SubmitBlockRequest struct {
+	TemplateID string
+	Nonce      int
+}
+
+// SimulateResult is a dry run of a transaction. Error is set when the pool would
+// refuse it; the fee is still what it would cost.
+type SimulateResult struct {
+	blockchain.Simulation
+	Error *ErrorBody `json:",omitempty"`
+}
+
+// SendTransactionResult is returned when a transaction enters the pool. The ID
+// follows it through tx_get.
+type SendTransactionResult struct {
+	ID     string
+	Status blockchain.TxState // pending, or queued behind a full block
+}
+
+// methods returns the method registry of the server
+func (s *Server) methods() []method {
+	return []method{
+		{
+			name: "chain_head", verb: http.MethodGet, path: "/chain/head",
+			call: func(ctx context.Context, _ interface{}) (interface{}, error) {
+				return s.bc.Head(), nil
+			},
+		},
+		{
+			name: "chain_getBlocks", verb: http.MethodGet, path: "/blocks",
+			params: func() interface{} { return &BlocksParams{} },
+			call: func(ctx context.Context, p interface{}) (interface{}, error) {
+				q := p.(*BlocksParams)
+				if q.Before < 0 || q.Limit < 0 {
+					return nil, invalidParams("before and limit must be non-negative")
+				}
+				return s.bc.GetBlocks(blockchain.BlockQuery{Before: q.Before, Limit: q.Limit}), nil
+			},
+		},
+		{
+			name: "chain_getBlock", verb: http.MethodGet, path: "/blocks/{ref}",
+			params: func() interface{} { return &BlockParams{} },
+			call: func(ctx context.Context, p interface{}) (interface{}, error) {
+				ref := string(p.(*BlockParams).Ref)
+				var block *blockchain.Block
+				var ok bool
+				if height, err := strconv.Atoi(ref); err == nil {
+					block, ok = s.bc.GetBlockByHeight(height)
+				} else {
+					block, ok = s.bc.GetBlockByHash(ref)
+				}
+				if !ok {
+					return nil, notFound("block not found")
+				}
+				return block, nil
+			},
+		},
+		{
+			name: "chain_getSupply", verb: http.MethodGet, path: "/getSupply",
+			call: func(ctx context.Context, _ interface{}) (interface{}, error) {
+				return s.bc.Supply(), nil
+			},
+		},
+		{
+			name: "tx_send", verb: http.MethodPost, path: "/sendTransaction",
+			params: func() interface{} { return &transaction.Transaction{} },
+			call: func(ctx context.Context, p interface{}) (interface{}, error) {
+				tx := p.(*transaction.Transaction)
+				if err := s.bc.AddTransactionToPool(*tx); err != nil {
+					return nil, chainError(err)
+				}
+				result := SendTransactionResult{ID: tx.ID(), Status: blockchain.TxPending}
+				if status, ok := s.bc.TransactionStatus(result.ID); ok {
+					result.Status = status.Status
+				}
+				return result, nil
+			},
+		},
+		{
+			name: "tx_simulate", verb: http.MethodPost, path: "/simulateTransaction",
+			params: func() interface{} { return &SimulateParams{} },
+			call: func(ctx context.Context, p interface{}) (interface{}, error) {
+				q := p.(*SimulateParams)
+				result := SimulateResult{Simulation: s.bc.SimulateTransaction(q.Transaction, !q.Unsigned)}
+				if result.Err != nil {
+					merr := asMethodError(chainError(result.Err))
+					result.Error = &ErrorBody{Code: merr.apiCode, Message: merr.message, Details: merr.details}
+				}
+				return result, nil
+			},
+		},
+		{
+			name: "tx_get", verb: http.MethodGet, path: "/txs/{id}",
+			params: func() interface{} { return &TxParams{} },
+			call: func(ctx context.Context, p interface{}) (interface{}, error) {
+				status, ok := s.bc.TransactionStatus(p.(*TxParams).ID)
+				if !ok {
+					return nil, notFound("transaction not found")
+				}
+				return status, nil
+			},
+		},
+		{
+			name: "account_get", verb: http.MethodGet, path: "/accounts/{address}",
+			params: func() interface{} { return &AddressParams{} },
+			call: func(ctx context.Context, p interface{}) (interface{}, error) {
+				address := p.(*AddressParams).Address
+				if address == "" {
+					return nil, invalidParams("address required")
+				}
+				return s.bc.GetAccount(address), nil
+			},
+		},
+		{
+			name: "account_getStake", verb: http.MethodGet, path: "/getStake",
+			params: func() interface{} { return &AddressParams{} },
+			call: func(ctx context.Context, p interface{}) (interface{}, error) {
+				address := p.(*AddressParams).Address
+				if address == "" {
+					return nil, invalidParams("address required")
+				}
+				return s.bc.GetStake(address), nil
+			},
+		},
+		{
+			name: "account_getDelegations", verb: http.MethodGet, path: "/getDelegations",
+			params: func() interface{} { return &AddressParams{} },
+			call: func(ctx context.Context, p interface{}) (interface{}, error) {
+				address := p.(*AddressParams).Address
+				if address == "" {
+					return nil, invalidParams("address required")
+				}
+				return s.bc.GetDelegations(address), nil
+			},
+		},
+		{
+			name: "mempool_list", verb: http.MethodGet, path: "/mempool",
+			params: func() interface{} { return &MempoolParams{} },
+			call: func(ctx context.Context, p interface{}) (interface{}, error) {
+				q := p.(*MempoolParams)
+				if q.Offset < 0 || q.Limit < 0 {
+					return nil, invalidParams("offset and limit must be non-negative")
+				}
+				return s.bc.GetMempool(q.Offset, q.Limit), nil
+			},
+		},
+		{
+			name: "fee_estimate", verb: http.MethodGet, path: "/estimateFee",
+			params: func() interface{} { return &EstimateFeeParams{} },
+			call: func(ctx context.Context, p interface{}) (interface{}, error) {
+				q := p.(*EstimateFeeParams)
+				if q.Blocks < 0 {
+					return nil, invalidParams("blocks must be a positive integer")
+				}
+				if q.Confidence != 0 && !(q.Confidence > 0 && q.Confidence < 1) {
+					return nil, invalidParams("confidence must be between 0 and 1")
+				}
+				return s.bc.EstimateFee(blockchain.FeeEstimateRequest{
+					Blocks:          q.Blocks,
+					Confidence:      q.Confidence,
+					From:            q.From,
+					IsTokenTransfer: q.Token,
+				}), nil
+			},
+		},
+		{
+			name: "mining_getBlockTemplate", verb: http.MethodGet, path: "/getBlockTemplate",
+			params: func() interface{} { return &BlockTemplateParams{} },
+			call: func(ctx context.Context, p interface{}) (interface{}, error) {
+				miner := p.(*BlockTemplateParams).Miner
+				if miner == "" {
+					return nil, invalidParams("miner address required")
+				}
+				return s.bc.GetBlockTemplate(miner, nil), nil
+			},
+		},
+		{
+			name: "mining_submitBlock", verb: http.MethodPost, path: "/submitBlock",
+			params: func() interface{} { return &SubmitBlockRequest{} },
+			call: func(ctx context.Context, p interface{}) (interface{}, error) {
+				req := p.(*SubmitBlockRequest)
+				block, err := s.bc.SubmitBlock(req.TemplateID, req.Nonce)
+				if err != nil {
+					return nil, chainError(err)
+				}
+				return block, nil
+			},
+		},
+		{
+			name: "mining_start", verb: http.MethodPost, path: "/mining/start",
+			params: func() interface{} { return &MiningStartParams{} },
+			call: func(ctx context.Context, p interface{}) (interface{}, error) {
+				if s.miner == nil {
+					return nil, unavailable("mining control is not available")
+				}
+				if err := requireControl(ctx); err != nil {
+					return nil, err
+				}
+				address := p.(*MiningStartParams).Address
+				if address != "" && address != s.control.MinerAddress && accessFrom(ctx) != accessToken {
+					return nil, forbidden("mining to another address than the configured miner requires the control token")
+				}
+				if err := s.miner.StartMining(address); err != nil {
+					return nil, rejected(err.Error())
+				}
+				return s.miner.MiningStatus(), nil
+			},
+		},
+		{
+			name: "mining_stop", verb: http.MethodPost, path: "/mining/stop",
+			call: func(ctx context.Context, _ interface{}) (interface{}, error) {
+				if s.miner == nil {
+					return nil, unavailable("mining control is not available")
+				}
+				if err := requireControl(ctx); err != nil {
+					return nil, err
+				}
+				if err := s.miner.StopMining(); err != nil {
+					return nil, rejected(err.Error())
+				}
+				return s.miner.MiningStatus(), nil
+			},
+		},
+		{
+			name: "mining_status", verb: http.MethodGet, path: "/mining/status",
+			call: func(ctx context.Context, _ interface{}) (interface{}, error) {
+				if s.miner == nil {
+					return MiningStatus{Hashrate: s.bc.Hashrate()}, nil
+				}
+				return s.miner.MiningStatus(), nil
+			},
+		},
+		{
+			name: "node_health",
+			call: func(ctx context.Context, _ interface{}) (interface{}, error) {
+				report, _ := s.Health()
+				return report, nil
+			},
+		},
+		{
+			name: "log_getLevels", verb: http.MethodGet, path: "/log/levels",
+			call: func(ctx context.Context, _ interface{}) (interface{}, error) {
+				return s.logLevels(), nil
+			},
+		},
+		{
+			name: "log_setLevel", verb: http.MethodPost, path: "/log/levels",
+			params: func() interface{} { return &LogLevelParams{} },
+			call: func(ctx context.Context, p interface{}) (interface{}, error) {
+				if err := requireControl(ctx); err != nil {
+					return nil, err
+				}
+				q := p.(*LogLevelParams)
+				if q.Level == "" {
+					if q.Component == "" {
+						return nil, invalidParams("level required for the default")
+					}
+					s.log.ResetLevel(q.Component)
+					return s.logLevels(), nil
+				}
+				level, err := logging.ParseLevel(q.Level)
+				if err != nil {
+					return nil, invalidParams(err.Error())
+				}
+				s.log.SetLevel(q.Component, level)
+				s.log.Info("Log level changed", "target", q.Component, "level", level)
+				return s.logLevels(), nil
+			},
+		},
+	}
+}
+
+// logLevels returns the current log levels
+func (s *Server) logLevels() LogLevels {
+	level, levels := s.log.Levels()
+	return LogLevels{Default: level, Components: levels}
+}
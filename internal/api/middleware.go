@@ -0,0 +1,107 @@
+package api
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+	"unknownberrytrip/internal/metrics"
+)
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Hijack lets WebSocket upgrades take over the connection
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("connection cannot be hijacked")
+	}
+	r.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+// apiMetrics are the request metrics of the server
+type apiMetrics struct {
+	requests *metrics.CounterVec   // By route and status code
+	latency  *metrics.HistogramVec // By route
+	rpcCalls *metrics.CounterVec   // By JSON-RPC method and error code, 0 on success
+}
+
+// LatencyBuckets are the bounds of the request latency histogram, in seconds
+var LatencyBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+func newAPIMetrics(r *metrics.Registry) apiMetrics {
+	return apiMetrics{
+		requests: r.NewCounterVec("unbt_api_requests_total", "HTTP requests served, by route and status code.", "route", "code"),
+		latency:  r.NewHistogramVec("unbt_api_request_duration_seconds", "HTTP request latency, by route.", LatencyBuckets, "route"),
+		rpcCalls: r.NewCounterVec("unbt_api_rpc_calls_total", "JSON-RPC calls, by method and error code (0 on success).", "method", "code"),
+	}
+}
+
+// instrument logs every request at debug level and records its status and latency
+func (s *Server) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		elapsed := time.Since(start)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		route := s.route(r)
+		if rec.status != http.StatusSwitchingProtocols {
+			// WebSocket sessions last as long as the client wants
+			s.apiMetrics.latency.With(route).Observe(elapsed.Seconds())
+		}
+		s.apiMetrics.requests.With(route, strconv.Itoa(rec.status)).Inc()
+		s.log.Debug("Request", "method", r.Method, "path", r.URL.Path, "status", rec.status, "duration", elapsed, "remote", r.RemoteAddr)
+	})
+}
+
+// route names the endpoint of a request for metrics: the registry method, the
+// path of the fixed endpoints without its slash, or other so unknown paths make no new series
+func (s *Server) route(r *http.Request) string {
+	switch r.URL.Path {
+	case "/rpc":
+		return "rpc"
+	case "/ws":
+		return "ws"
+	case "/metrics", "/healthz", "/readyz":
+		return r.URL.Path[1:]
+	}
+	route := "other"
+	for _, m := range s.registry {
+		if m.path == "" {
+			continue
+		}
+		if _, ok := matchPath(m.path, r.URL.Path); ok {
+			if m.verb == r.Method || (m.verb == http.MethodGet && r.Method == http.MethodHead) {
+				return m.name
+			}
+			if route == "other" {
+				route = m.name
+			}
+		}
+	}
+	return route
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// serveREST dispatches a request to the method whose REST route matches it
+func (s *Server) serveREST(w http.ResponseWriter, r *http.Request) {
+	var allowed []string
+	for _, m := range s.registry {
+		if m.path == "" {
+			continue
+		}
+		vars, ok := matchPath(m.path, r.URL.Path)
+		if !ok {
+			continue
+		}
+		allowed = append(allowed, m.verb)
+		if r.Method != m.verb && !(m.verb == http.MethodGet && r.Method == http.MethodHead) {
+			continue
+		}
+		s.callREST(w, r, m, vars)
+		return
+	}
+	if len(allowed) > 0 {
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "method not allowed", nil)
+		return
+	}
+	writeError(w, http.StatusNotFound, ErrCodeNotFound, "no route for "+r.URL.Path, nil)
+}
+
+// callREST binds the body, path and query to the method params and writes the result
+func (s *Server) callREST(w http.ResponseWriter, r *http.Request, m method, vars map[string]string) {
+	if r.Method == http.MethodPost && !isJSON(r) {
+		writeError(w, http.StatusUnsupportedMediaType, ErrCodeUnsupportedMedia, "Content-Type must be application/json", nil)
+		return
+	}
+	var params interface{}
+	if m.params != nil {
+		params = m.params()
+		if r.Method == http.MethodPost {
+			if err := json.NewDecoder(r.Body).Decode(params); err != nil && !errors.Is(err, io.EOF) {
+				writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid JSON body: "+err.Error(), nil)
+				return
+			}
+		}
+		for name, values := range r.URL.Query() {
+			if _, ok := vars[name]; !ok && len(values) > 0 {
+				vars[name] = values[0]
+			}
+		}
+		if err := bindValues(params, vars); err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidParams, err.Error(), nil)
+			return
+		}
+	}
+	result, err := m.call(r.Context(), params)
+	if err != nil {
+		writeMethodError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// matchPath matches a path against a pattern whose {name} segments capture values
+func matchPath(pattern, path string) (map[string]string, bool) {
+	want := strings.Split(strings.Trim(pattern, "/"), "/")
+	got := strings.Split(strings.Trim(path, "/"), "/")
+	if len(want) != len(got) {
+		return nil, false
+	}
+	vars := make(map[string]string)
+	for i, segment := range want {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			if got[i] == "" {
+				return nil, false
+			}
+			vars[segment[1:len(segment)-1]] = got[i]
+		} else if segment != got[i] {
+			return nil, false
+		}
+	}
+	return vars, true
+}
+
+// bindValues sets the fields of the struct pointed to by params from string values,
+// matching field JSON names case-insensitively
+func bindValues(params interface{}, values map[string]string) error {
+	v := reflect.ValueOf(params).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" {
+			name = field.Name
+		}
+		var raw string
+		found := false
+		for key, value := range values {
+			if strings.EqualFold(key, name) {
+				raw, found = value, true
+				break
+			}
+		}
+		if !found {
+			continue
+		}
+		f := v.Field(i)
+		switch f.Kind() {
+		case reflect.String:
+			f.SetString(raw)
+		case reflect.Int:
+			n, err := strconv.Atoi(raw)
+			if err != nil {
+				return fmt.Errorf("%s must be an integer", name)
+			}
+			f.SetInt(int64(n))
+		case reflect.Float64:
+			x, err := strconv.ParseFloat(raw, 64)
+			if err != nil {
+				return fmt.Errorf("%s must be a number", name)
+			}
+			f.SetFloat(x)
+		case reflect.Bool:
+			b, err := strconv.ParseBool(raw)
+			if err != nil {
+				return fmt.Errorf("%s must be a boolean", name)
+			}
+			f.SetBool(b)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// JSON-RPC 2.0 error codes. Codes above -32000 are defined by the specification,
+// the others are server errors.
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeInternalError  = -32603
+	codeRejected       = -32000 // Transaction or block refused by the node
+	codeNotFound       = -32001 // Block, transaction or account does not exist
+	codeUnavailable    = -32002 // Feature not enabled on this node
+	codeForbidden      = -32003 // Control method called without the control token
+)
+
+// maxBatchSize bounds the calls of one batch request
+const maxBatchSize = 100
+
+// RPCRequest is a JSON-RPC 2.0 request; a request without ID is a notification
+type RPCRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+}
+
+// RPCResponse is a JSON-RPC 2.0 response
+type RPCResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// RPCError is the error member of a JSON-RPC 2.0 response
+type RPCError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// handleRPC serves JSON-RPC 2.0 single and batch requests over POST
+func (s *Server) handleRPC(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "method not allowed", nil)
+		return
+	}
+	if !isJSON(r) {
+		writeError(w, http.StatusUnsupportedMediaType, ErrCodeUnsupportedMedia, "Content-Type must be application/json", nil)
+		return
+	}
+	var body json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, http.StatusOK, rpcFailure(nil, codeParseError, "parse error"))
+		return
+	}
+	resp, ok := s.processRPC(r.Context(), body)
+	if !ok {
+		w.WriteHeader(http.StatusNoContent) // Only notifications
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// processRPC executes a single or batch request and returns the response, an
+// RPCResponse or a slice of them. The second result is false when nothing is to
+// be sent back because the request held only notifications.
+func (s *Server) processRPC(ctx context.Context, body []byte) (interface{}, bool) {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 || trimmed[0] != '[' {
+		if !json.Valid(trimmed) {
+			return rpcFailure(nil, codeParseError, "parse error"), true
+		}
+		resp, ok := s.callRPC(ctx, trimmed)
+		return resp, ok
+	}
+	var batch []json.RawMessage
+	if err := json.Unmarshal(trimmed, &batch); err != nil {
+		return rpcFailure(nil, codeParseError, "parse error"), true
+	}
+	if len(batch) == 0 || len(batch) > maxBatchSize {
+		return rpcFailure(nil, codeInvalidRequest, "batch must hold 1 to 100 requests"), true
+	}
+	var responses []RPCResponse
+	for _, raw := range batch {
+		if resp, ok := s.callRPC(ctx, raw); ok {
+			responses = append(responses, resp)
+		}
+	}
+	if len(responses) == 0 {
+		return nil, false
+	}
+	return responses, true
+}
+
+// callRPC executes one request. The second result is false for notifications,
+// which get no response.
+func (s *Server) callRPC(ctx context.Context, raw json.RawMessage) (RPCResponse, bool) {
+	var req RPCRequest
+	if err := json.Unmarshal(raw, &req); err != nil || req.JSONRPC != "2.0" || req.Method == "" {
+		return rpcFailure(nil, codeInvalidRequest, "invalid request"), true
+	}
+	notification := len(req.ID) == 0
+	reply := func(resp RPCResponse) (RPCResponse, bool) {
+		return resp, !notification
+	}
+
+	m, ok := s.methodsByName[req.Method]
+	if !ok {
+		s.apiMetrics.rpcCalls.With("unknown", strconv.Itoa(codeMethodNotFound)).Inc()
+		return reply(rpcFailure(req.ID, codeMethodNotFound, "method not found"))
+	}
+	resp := s.invokeRPC(ctx, m, req)
+	code := 0
+	if resp.Error != nil {
+		code = resp.Error.Code
+	}
+	s.apiMetrics.rpcCalls.With(m.name, strconv.Itoa(code)).Inc()
+	return reply(resp)
+}
+
+// invokeRPC decodes the params of a request and calls its method
+func (s *Server) invokeRPC(ctx context.Context, m method, req RPCRequest) RPCResponse {
+	var params interface{}
+	if m.params != nil {
+		params = m.params()
+		if len(req.Params) > 0 && !bytes.Equal(bytes.TrimSpace(req.Params), []byte("null")) {
+			if err := json.Unmarshal(req.Params, params); err != nil {
+				return rpcFailure(req.ID, codeInvalidParams, "invalid params: "+err.Error())
+			}
+		}
+	}
+	result, err := m.call(ctx, params)
+	if err != nil {
+		return RPCResponse{JSONRPC: "2.0", Error: rpcError(err), ID: req.ID}
+	}
+	return RPCResponse{JSONRPC: "2.0", Result: result, ID: req.ID}
+}
+
+// rpcFailure builds an error response; id is null when the request ID is unknown
+func rpcFailure(id json.RawMessage, code int, message string) RPCResponse {
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+	return RPCResponse{JSONRPC: "2.0", Error: &RPCError{Code: code, Message: message}, ID: id}
+}
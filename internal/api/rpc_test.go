@@ -0,0 +1,392 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unknownberrytrip/internal/blockchain"
+	"unknownberrytrip/internal/logging"
+	"unknownberrytrip/internal/wallet"
+)
+
+// postRPC sends body to /rpc and returns the status and raw response
+func postRPC(t *testing.T, url, body string) (int, []byte) {
+	t.Helper()
+	resp, err := http.Post(url+"/rpc", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST /rpc failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var raw json.RawMessage
+	if resp.StatusCode != http.StatusNoContent {
+		if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+			t.Fatalf("Decoding response failed: %v", err)
+		}
+	}
+	return resp.StatusCode, raw
+}
+
+func TestRPCSingleAndBatch(t *testing.T) {
+	senderWallet := wallet.NewWallet()
+	params := blockchain.DefaultChainParams()
+	params.GenesisAlloc[senderWallet.Address] = 10.0
+	bc := blockchain.NewBlockchainWithParams(params)
+	srv := httptest.NewServer(NewServer(bc, "").Handler())
+	defer srv.Close()
+
+	tx := senderWallet.CreateTransaction("receiver", 1.0, 0)
+	txJSON, _ := json.Marshal(tx)
+	_, raw := postRPC(t, srv.URL, `{"jsonrpc":"2.0","id":1,"method":"tx_send","params":`+string(txJSON)+`}`)
+	var sent struct {
+		Result SendTransactionResult
+		Error  *RPCError
+	}
+	json.Unmarshal(raw, &sent)
+	if sent.Error != nil || sent.Result.ID != tx.ID() || sent.Result.Status != blockchain.TxPending {
+		t.Fatalf("Expected tx_send to return the transaction ID, got %s", raw)
+	}
+
+	status, raw := postRPC(t, srv.URL, `[
+		{"jsonrpc":"2.0","id":"a","method":"account_get","params":{"address":"`+senderWallet.Address+`"}},
+		{"jsonrpc":"2.0","id":"b","method":"chain_getBlock","params":{"ref":0}},
+		{"jsonrpc":"2.0","id":"c","method":"no_such_method"},
+		{"jsonrpc":"2.0","id":"d","method":"tx_get","params":{"id":"missing"}},
+		{"jsonrpc":"2.0","id":"e","method":"chain_getBlocks","params":[1]},
+		{"jsonrpc":"2.0","method":"chain_head"},
+		{"id":"f","method":"chain_head"}
+	]`)
+	if status != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", status)
+	}
+	var batch []struct {
+		ID     string
+		Result json.RawMessage
+		Error  *RPCError
+	}
+	if err := json.Unmarshal(raw, &batch); err != nil {
+		t.Fatalf("Expected a batch response, got %s", raw)
+	}
+	if len(batch) != 6 {
+		t.Fatalf("Expected 6 responses without the notification, got %d: %s", len(batch), raw)
+	}
+	var account blockchain.AccountState
+	json.Unmarshal(batch[0].Result, &account)
+	if batch[0].ID != "a" || account.Pending.Nonce != 1 {
+		t.Errorf("Expected the account with the pending transaction, got %s", batch[0].Result)
+	}
+	if batch[1].Error != nil {
+		t.Errorf("Expected genesis block, got error %+v", batch[1].Error)
+	}
+	wantCodes := map[int]int{2: codeMethodNotFound, 3: codeNotFound, 4: codeInvalidParams, 5: codeInvalidRequest}
+	for i, code := range wantCodes {
+		if batch[i].Error == nil || batch[i].Error.Code != code {
+			t.Errorf("Expected response %d to fail with code %d, got %+v", i, code, batch[i].Error)
+		}
+	}
+
+	_, raw = postRPC(t, srv.URL, `{"jsonrpc":"2.0",`)
+	var parseErr RPCResponse
+	json.Unmarshal(raw, &parseErr)
+	if parseErr.Error == nil || parseErr.Error.Code != codeParseError || string(parseErr.ID) != "null" {
+		t.Errorf("Expected a parse error with null ID, got %s", raw)
+	}
+	if status, _ := postRPC(t, srv.URL, `{"jsonrpc":"2.0","method":"chain_head"}`); status != http.StatusNoContent {
+		t.Errorf("Expected no content for a notification, got %d", status)
+	}
+	_, raw = postRPC(t, srv.URL, `[]`)
+	var empty RPCResponse
+	json.Unmarshal(raw, &empty)
+	if empty.Error == nil || empty.Error.Code != codeInvalidRequest {
+		t.Errorf("Expected an empty batch to be invalid, got %s", raw)
+	}
+}
+
+func TestRESTSharesRegistry(t *testing.T) {
+	bc := blockchain.NewBlockchain()
+	srv := httptest.NewServer(NewServer(bc, "").Handler())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/mining/status")
+	if err != nil {
+		t.Fatalf("GET /mining/status failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected mining status without control, got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Post(srv.URL+"/mining/start", "application/json", nil)
+	if err != nil {
+		t.Fatalf("POST /mining/start failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 without mining control, got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Post(srv.URL+"/blocks/0", "application/json", nil)
+	if err != nil {
+		t.Fatalf("POST /blocks/0 failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed || resp.Header.Get("Allow") != http.MethodGet {
+		t.Errorf("Expected 405 allowing GET, got %d allowing %q", resp.StatusCode, resp.Header.Get("Allow"))
+	}
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	senderWallet := wallet.NewWallet()
+	params := blockchain.DefaultChainParams()
+	params.GenesisAlloc[senderWallet.Address] = 10.0
+	bc := blockchain.NewBlockchainWithParams(params)
+	srv := httptest.NewServer(NewServer(bc, "").Handler())
+	defer srv.Close()
+
+	send := func(body string) (int, ErrorBody) {
+		t.Helper()
+		resp, err := http.Post(srv.URL+"/sendTransaction", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("POST /sendTransaction failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var envelope ErrorResponse
+		json.NewDecoder(resp.Body).Decode(&envelope)
+		return resp.StatusCode, envelope.Error
+	}
+	gap, _ := json.Marshal(senderWallet.CreateTransaction("receiver", 1.0, 3))
+	status, body := send(string(gap))
+	if status != http.StatusBadRequest || body.Code != "NONCE_GAP" || body.Details["expected"] != 0.0 || body.Details["got"] != 3.0 {
+		t.Errorf("Expected NONCE_GAP with both nonces, got %d %+v", status, body)
+	}
+	poor, _ := json.Marshal(senderWallet.CreateTransaction("receiver", 50.0, 0))
+	if status, body = send(string(poor)); body.Code != "INSUFFICIENT_BALANCE" || body.Details["required"] != 50.0 {
+		t.Errorf("Expected INSUFFICIENT_BALANCE with the required amount, got %d %+v", status, body)
+	}
+	if status, body = send("{"); status != http.StatusBadRequest || body.Code != ErrCodeInvalidRequest {
+		t.Errorf("Expected INVALID_REQUEST for a truncated body, got %d %+v", status, body)
+	}
+
+	resp, err := http.Get(srv.URL + "/sendTransaction")
+	if err != nil {
+		t.Fatalf("GET /sendTransaction failed: %v", err)
+	}
+	var envelope ErrorResponse
+	json.NewDecoder(resp.Body).Decode(&envelope)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed || envelope.Error.Code != ErrCodeMethodNotAllowed {
+		t.Errorf("Expected METHOD_NOT_ALLOWED, got %d %+v", resp.StatusCode, envelope)
+	}
+
+	_, raw := postRPC(t, srv.URL, `{"jsonrpc":"2.0","id":1,"method":"tx_send","params":`+string(gap)+`}`)
+	var rpcResp struct {
+		Error struct {
+			Code int
+			Data ErrorData
+		}
+	}
+	json.Unmarshal(raw, &rpcResp)
+	if rpcResp.Error.Code != codeRejected || rpcResp.Error.Data.Code != "NONCE_GAP" || rpcResp.Error.Data.Details["expected"] != 0.0 {
+		t.Errorf("Expected the error code in the RPC error data, got %s", raw)
+	}
+}
+
+func TestLogLevelMethods(t *testing.T) {
+	var out bytes.Buffer
+	logger := logging.New(&out, logging.Options{Level: logging.LevelInfo})
+	s := NewServer(blockchain.NewBlockchain(), "")
+	s.SetLogger(logger)
+	srv := httptest.NewServer(s.Handler())
+	defer srv.Close()
+
+	_, raw := postRPC(t, srv.URL, `{"jsonrpc":"2.0","id":1,"method":"log_setLevel","params":{"component":"api","level":"debug"}}`)
+	var resp struct {
+		Result LogLevels
+		Error  *RPCError
+	}
+	json.Unmarshal(raw, &resp)
+	if resp.Error != nil || resp.Result.Default != logging.LevelInfo || resp.Result.Components["api"] != logging.LevelDebug {
+		t.Fatalf("Expected api at debug, got %s", raw)
+	}
+	out.Reset()
+	http.Get(srv.URL + "/chain/head")
+	if !strings.Contains(out.String(), "path=/chain/head") {
+		t.Errorf("Expected the request logged at debug, got %q", out.String())
+	}
+
+	_, raw = postRPC(t, srv.URL, `{"jsonrpc":"2.0","id":2,"method":"log_setLevel","params":{"component":"api","level":"loud"}}`)
+	json.Unmarshal(raw, &resp)
+	if resp.Error == nil || resp.Error.Code != codeInvalidParams {
+		t.Errorf("Expected an unknown level to be invalid, got %s", raw)
+	}
+
+	rec := serve(s.Handler(), http.MethodPost, "/log/levels", "203.0.113.5:4000", "", `{"component":"api","level":"off"}`)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected a remote client to be refused without a token, got %d", rec.Code)
+	}
+	s.SetControlOptions(ControlOptions{Token: "secret"})
+	if rec := serve(s.Handler(), http.MethodPost, "/log/levels", "127.0.0.1:4000", "", `{"component":"api","level":"off"}`); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected loopback clients to need the configured token, got %d", rec.Code)
+	}
+	if _, levels := s.log.Levels(); levels["api"] != logging.LevelDebug {
+		t.Errorf("Expected refused calls to leave api at debug, got %v", levels["api"])
+	}
+	if rec := serve(s.Handler(), http.MethodPost, "/log/levels", "203.0.113.5:4000", "secret", `{"component":"api","level":"off"}`); rec.Code != http.StatusOK {
+		t.Errorf("Expected the token to change levels, got %d", rec.Code)
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	senderWallet := wallet.NewWallet()
+	params := blockchain.DefaultChainParams()
+	params.GenesisAlloc[senderWallet.Address] = 10.0
+	bc := blockchain.NewBlockchainWithParams(params)
+	s := NewServer(bc, "")
+	defer s.Shutdown(context.Background())
+	srv := httptest.NewServer(s.Handler())
+	defer srv.Close()
+
+	tx := senderWallet.CreateTransaction("receiver", 1.0, 0)
+	bc.AddTransactionToPool(*tx)
+	bc.AddTransactionToPool(*tx)
+	http.Get(srv.URL + "/chain/head")
+
+	want := []string{
+		"unbt_pool_size 1",
+		"unbt_pool_tx_accepted_total 1",
+		`unbt_pool_tx_rejected_total{reason="nonce_too_low"} 1`,
+		`unbt_api_requests_total{route="chain_head",code="200"} 1`,
+		`unbt_api_request_duration_seconds_count{route="chain_head"} 1`,
+		"# TYPE unbt_block_interval_seconds histogram",
+	}
+	var body string
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, err := http.Get(srv.URL + "/metrics")
+		if err != nil {
+			t.Fatalf("GET /metrics failed: %v", err)
+		}
+		data, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		body = string(data)
+		missing := ""
+		for _, line := range want {
+			if !strings.Contains(body, line+"\n") {
+				missing = line
+			}
+		}
+		if missing == "" {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %q in metrics:\n%s", missing, body)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// stubMiner records the addresses it is started with
+type stubMiner struct {
+	started []string
+	running bool
+}
+
+func (m *stubMiner) StartMining(address string) error {
+	m.started = append(m.started, address)
+	m.running = true
+	return nil
+}
+
+func (m *stubMiner) StopMining() error {
+	m.running = false
+	return nil
+}
+
+func (m *stubMiner) MiningStatus() MiningStatus {
+	return MiningStatus{Running: m.running}
+}
+
+// serve sends a request through the handler as a client at remoteAddr
+func serve(h http.Handler, method, path, remoteAddr, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.RemoteAddr = remoteAddr
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestControlMethodsRequireAccess(t *testing.T) {
+	s := NewServer(blockchain.NewBlockchain(), "")
+	miner := &stubMiner{}
+	s.SetMiningControl(miner)
+	s.SetControlOptions(ControlOptions{MinerAddress: "operator"})
+	h := s.Handler()
+
+	if rec := serve(h, http.MethodPost, "/mining/start", "203.0.113.5:4000", "", ""); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected a remote client to be refused without a token, got %d", rec.Code)
+	}
+	if rec := serve(h, http.MethodPost, "/mining/start", "127.0.0.1:4000", "", `{"address":"attacker"}`); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected a loopback client to be refused another miner address, got %d", rec.Code)
+	}
+	if rec := serve(h, http.MethodPost, "/mining/start", "127.0.0.1:4000", "", `{"address":"operator"}`); rec.Code != http.StatusOK {
+		t.Errorf("Expected a loopback client to start the configured miner, got %d: %s", rec.Code, rec.Body)
+	}
+	rec := serve(h, http.MethodPost, "/rpc", "203.0.113.5:4000", "", `{"jsonrpc":"2.0","method":"mining_stop","id":1}`)
+	var resp RPCResponse
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if resp.Error == nil || resp.Error.Code != codeForbidden || !miner.running {
+		t.Errorf("Expected mining_stop over RPC to be forbidden remotely, got %s", rec.Body)
+	}
+
+	s.SetControlOptions(ControlOptions{Token: "secret", MinerAddress: "operator"})
+	if rec := serve(h, http.MethodPost, "/mining/stop", "127.0.0.1:4000", "", ""); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected loopback clients to need the configured token, got %d", rec.Code)
+	}
+	if rec := serve(h, http.MethodPost, "/mining/stop", "203.0.113.5:4000", "wrong", ""); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected a wrong token to be refused, got %d", rec.Code)
+	}
+	if rec := serve(h, http.MethodPost, "/mining/stop", "203.0.113.5:4000", "secret", ""); rec.Code != http.StatusOK || miner.running {
+		t.Errorf("Expected the token to stop mining, got %d", rec.Code)
+	}
+	if rec := serve(h, http.MethodPost, "/mining/start", "203.0.113.5:4000", "secret", `{"address":"other"}`); rec.Code != http.StatusOK {
+		t.Errorf("Expected the token to allow another miner address, got %d", rec.Code)
+	}
+	if got := strings.Join(miner.started, ","); got != "operator,other" {
+		t.Errorf("Expected mining started for operator then other, got %s", got)
+	}
+}
+
+func TestPostsRequireJSONContentType(t *testing.T) {
+	srv := httptest.NewServer(NewServer(blockchain.NewBlockchain(), "").Handler())
+	defer srv.Close()
+
+	for _, path := range []string{"/sendTransaction", "/rpc"} {
+		resp, err := http.Post(srv.URL+path, "text/plain", strings.NewReader(`{}`))
+		if err != nil {
+			t.Fatalf("POST %s failed: %v", path, err)
+		}
+		var envelope ErrorResponse
+		json.NewDecoder(resp.Body).Decode(&envelope)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnsupportedMediaType || envelope.Error.Code != ErrCodeUnsupportedMedia {
+			t.Errorf("Expected 415 %s for a text/plain POST to %s, got %d %q", ErrCodeUnsupportedMedia, path, resp.StatusCode, envelope.Error.Code)
+		}
+	}
+	resp, err := http.Post(srv.URL+"/rpc", "application/json; charset=utf-8", strings.NewReader(`{"jsonrpc":"2.0","method":"chain_head","id":1}`))
+	if err != nil {
+		t.Fatalf("POST /rpc failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected a charset parameter to be accepted, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,241 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"unknownberrytrip/internal/blockchain"
+	"unknownberrytrip/internal/transaction"
+)
+
+// Subscription topics of the WebSocket endpoint
+const (
+	TopicNewHeads            = "newHeads"            // Every block appended to the chain
+	TopicPendingTransactions = "pendingTransactions" // Every transaction accepted into the pool
+	TopicActivity            = "activity"            // Pool and block transactions touching addresses or tokens
+)
+
+// eventBuffer is the number of chain events queued for a slow WebSocket client
+// before events are dropped
+const eventBuffer = 256
+
+// SubscribeParams are the params of the subscribe method
+type SubscribeParams struct {
+	Topic     string   `json:"topic"`
+	Addresses []string `json:"addresses"` // For activity: senders, recipients or fee payers to watch
+	Tokens    []string `json:"tokens"`    // For activity: token IDs to watch
+}
+
+// UnsubscribeParams are the params of the unsubscribe method
+type UnsubscribeParams struct {
+	ID string `json:"id"`
+}
+
+// SubscriptionNotification is the params of a subscription notification
+type SubscriptionNotification struct {
+	Subscription string      `json:"subscription"`
+	Result       interface{} `json:"result"`
+}
+
+// Activity is a transaction touching a watched address or token
+type Activity struct {
+	ID          string
+	Status      string // "pending" or "included"
+	Transaction transaction.Transaction
+	BlockHeight int    `json:",omitempty"`
+	BlockHash   string `json:",omitempty"`
+}
+
+// wsSubscription is one subscription of a WebSocket session
+type wsSubscription struct {
+	id        string
+	topic     string
+	addresses map[string]bool
+	tokens    map[string]bool
+}
+
+// touches reports whether tx involves a watched address or token
+func (sub *wsSubscription) touches(tx *transaction.Transaction) bool {
+	if sub.addresses[tx.From] || sub.addresses[tx.To] || (tx.FeePayer != "" && sub.addresses[tx.FeePayer]) {
+		return true
+	}
+	return tx.IsTokenTransfer && sub.tokens[tx.TokenID]
+}
+
+// wsSession serves JSON-RPC calls and subscriptions over one WebSocket connection
+type wsSession struct {
+	s      *Server
+	conn   *wsConn
+	mu     sync.Mutex
+	subs   []*wsSubscription // In subscription order
+	nextID int
+}
+
+// handleWebSocket upgrades the connection and serves the session until it closes.
+// Clients send JSON-RPC requests; subscribe and unsubscribe manage notifications.
+// Browsers may only connect from the node's own origin or an allowed one.
+func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	if !s.originAllowed(r) {
+		writeError(w, http.StatusForbidden, ErrCodeForbidden, "origin not allowed", nil)
+		return
+	}
+	conn, err := upgradeWebSocket(w, r)
+	if err != nil {
+		return
+	}
+	if !s.trackConn(conn) {
+		conn.Close()
+		return
+	}
+	defer s.untrackConn(conn)
+	defer conn.Close()
+
+	session := &wsSession{s: s, conn: conn}
+	events := s.bc.Subscribe(eventBuffer, blockchain.EventBlockImported, blockchain.EventTxAccepted)
+	defer events.Unsubscribe()
+	go session.forward(events)
+
+	// The request context ends when the handler returns, so calls use their own.
+	// It carries no control access: control methods are refused over /ws.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for {
+		message, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if resp, ok := session.handle(ctx, message); ok {
+			data, _ := json.Marshal(resp)
+			if err := conn.WriteText(data); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// handle executes one request, serving subscribe and unsubscribe itself
+func (ss *wsSession) handle(ctx context.Context, message []byte) (interface{}, bool) {
+	var req RPCRequest
+	if err := json.Unmarshal(message, &req); err != nil {
+		// Batches and malformed requests take the shared path
+		return ss.s.processRPC(ctx, message)
+	}
+	var result interface{}
+	var err error
+	switch req.Method {
+	case "subscribe":
+		var params SubscribeParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return rpcFailure(req.ID, codeInvalidParams, "invalid params"), true
+		}
+		result, err = ss.subscribe(params)
+	case "unsubscribe":
+		var params UnsubscribeParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return rpcFailure(req.ID, codeInvalidParams, "invalid params"), true
+		}
+		result, err = ss.unsubscribe(params.ID)
+	default:
+		return ss.s.processRPC(ctx, message)
+	}
+	if len(req.ID) == 0 {
+		return nil, false
+	}
+	if err != nil {
+		return RPCResponse{JSONRPC: "2.0", Error: rpcError(err), ID: req.ID}, true
+	}
+	return RPCResponse{JSONRPC: "2.0", Result: result, ID: req.ID}, true
+}
+
+// subscribe adds a subscription and returns its ID
+func (ss *wsSession) subscribe(params SubscribeParams) (string, error) {
+	sub := &wsSubscription{topic: params.Topic, addresses: make(map[string]bool), tokens: make(map[string]bool)}
+	switch params.Topic {
+	case TopicNewHeads, TopicPendingTransactions:
+	case TopicActivity:
+		for _, address := range params.Addresses {
+			sub.addresses[address] = true
+		}
+		for _, token := range params.Tokens {
+			sub.tokens[token] = true
+		}
+		if len(sub.addresses) == 0 && len(sub.tokens) == 0 {
+			return "", invalidParams("activity needs addresses or tokens")
+		}
+	default:
+		return "", invalidParams("unknown topic " + strconv.Quote(params.Topic))
+	}
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.nextID++
+	sub.id = strconv.Itoa(ss.nextID)
+	ss.subs = append(ss.subs, sub)
+	return sub.id, nil
+}
+
+// unsubscribe removes a subscription
+func (ss *wsSession) unsubscribe(id string) (bool, error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	for i, sub := range ss.subs {
+		if sub.id == id {
+			ss.subs = append(ss.subs[:i], ss.subs[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, notFound("subscription not found")
+}
+
+// forward turns chain events into notifications until the subscription closes
+func (ss *wsSession) forward(events *blockchain.Subscription) {
+	for ev := range events.C {
+		for _, n := range ss.notifications(ev) {
+			data, _ := json.Marshal(struct {
+				JSONRPC string                   `json:"jsonrpc"`
+				Method  string                   `json:"method"`
+				Params  SubscriptionNotification `json:"params"`
+			}{"2.0", "subscription", n})
+			if err := ss.conn.WriteText(data); err != nil {
+				ss.conn.conn.Close() // Ends the read loop, which unsubscribes
+				return
+			}
+		}
+	}
+}
+
+// notifications returns the notifications of ev for the current subscriptions
+func (ss *wsSession) notifications(ev blockchain.Event) []SubscriptionNotification {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	var out []SubscriptionNotification
+	for _, sub := range ss.subs {
+		id := sub.id
+		switch ev := ev.(type) {
+		case blockchain.BlockImported:
+			switch sub.topic {
+			case TopicNewHeads:
+				out = append(out, SubscriptionNotification{id, ev.Head})
+			case TopicActivity:
+				for j := range ev.Block.Transactions {
+					tx := &ev.Block.Transactions[j]
+					if sub.touches(tx) {
+						out = append(out, SubscriptionNotification{id, Activity{
+							ID: tx.ID(), Status: "included", Transaction: *tx,
+							BlockHeight: ev.Block.Index, BlockHash: ev.Block.Hash,
+						}})
+					}
+				}
+			}
+		case blockchain.TxAccepted:
+			switch {
+			case sub.topic == TopicPendingTransactions:
+				out = append(out, SubscriptionNotification{id, blockchain.PooledTransaction{ID: ev.ID, Transaction: *ev.Tx}})
+			case sub.topic == TopicActivity && sub.touches(ev.Tx):
+				out = append(out, SubscriptionNotification{id, Activity{ID: ev.ID, Status: "pending", Transaction: *ev.Tx}})
+			}
+		}
+	}
+	return out
+}
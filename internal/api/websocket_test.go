@@ -0,0 +1,216 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unknownberrytrip/internal/blockchain"
+	"unknownberrytrip/internal/transaction"
+	"unknownberrytrip/internal/wallet"
+)
+
+// dialWebSocket opens a client connection to a ws:// URL path on addr
+func dialWebSocket(addr, path string) (*wsConn, error) {
+	return dialWebSocketFrom(addr, path, "")
+}
+
+// dialWebSocketFrom opens a connection the way a browser on origin would
+func dialWebSocketFrom(addr, path, origin string) (*wsConn, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	key := base64.StdEncoding.EncodeToString(nonce)
+	header := ""
+	if origin != "" {
+		header = "Origin: " + origin + "\r\n"
+	}
+	fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Key: %s\r\nSec-WebSocket-Version: 13\r\n%s\r\n", path, addr, key, header)
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != wsAccept(key) {
+		conn.Close()
+		return nil, fmt.Errorf("websocket handshake failed: %s", resp.Status)
+	}
+	return &wsConn{conn: conn, br: br, client: true}, nil
+}
+
+// wsCall sends a request and returns the next message, failing the test on error
+func wsCall(t *testing.T, c *wsConn, request string) []byte {
+	t.Helper()
+	if err := c.WriteText([]byte(request)); err != nil {
+		t.Fatalf("WriteText failed: %v", err)
+	}
+	return wsNext(t, c)
+}
+
+func wsNext(t *testing.T, c *wsConn) []byte {
+	t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	message, err := c.ReadMessage()
+	if err != nil {
+		t.Fatalf("ReadMessage failed: %v", err)
+	}
+	return message
+}
+
+type wsNotification struct {
+	Method string
+	Params struct {
+		Subscription string
+		Result       json.RawMessage
+	}
+}
+
+func TestWebSocketSubscriptions(t *testing.T) {
+	senderWallet := wallet.NewWallet()
+	params := blockchain.DefaultChainParams()
+	params.GenesisAlloc[senderWallet.Address] = 10.0
+	bc := blockchain.NewBlockchainWithParams(params)
+	api := NewServer(bc, "")
+	srv := httptest.NewServer(api.Handler())
+	defer srv.Close()
+	c, err := dialWebSocket(strings.TrimPrefix(srv.URL, "http://"), "/ws")
+	if err != nil {
+		t.Fatalf("dialWebSocket failed: %v", err)
+	}
+	defer c.Close()
+
+	var sub struct {
+		Result string
+		Error  *RPCError
+	}
+	subscribe := func(id int, params string) string {
+		json.Unmarshal(wsCall(t, c, fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"subscribe","params":%s}`, id, params)), &sub)
+		if sub.Error != nil {
+			t.Fatalf("subscribe %s failed: %+v", params, sub.Error)
+		}
+		return sub.Result
+	}
+	heads := subscribe(1, `{"topic":"newHeads"}`)
+	pending := subscribe(2, `{"topic":"pendingTransactions"}`)
+	activity := subscribe(3, `{"topic":"activity","addresses":["receiver"]}`)
+	json.Unmarshal(wsCall(t, c, `{"jsonrpc":"2.0","id":4,"method":"subscribe","params":{"topic":"activity"}}`), &sub)
+	if sub.Error == nil || sub.Error.Code != codeInvalidParams {
+		t.Errorf("Expected activity without filters to be rejected, got %+v", sub.Error)
+	}
+	var head struct{ Result blockchain.ChainHead }
+	json.Unmarshal(wsCall(t, c, `{"jsonrpc":"2.0","id":5,"method":"chain_head"}`), &head)
+	if head.Result.Height != 0 {
+		t.Errorf("Expected regular methods over the socket, got %+v", head.Result)
+	}
+
+	tx := senderWallet.CreateTransaction("receiver", 1.0, 0)
+	if err := bc.AddTransactionToPool(*tx); err != nil {
+		t.Fatalf("AddTransactionToPool failed: %v", err)
+	}
+	bc.AddBlock([]transaction.Transaction{*tx}, "miner")
+
+	var got []wsNotification
+	for i := 0; i < 4; i++ {
+		var n wsNotification
+		json.Unmarshal(wsNext(t, c), &n)
+		if n.Method != "subscription" {
+			t.Fatalf("Expected a notification, got %+v", n)
+		}
+		got = append(got, n)
+	}
+	var pooled blockchain.PooledTransaction
+	var seen Activity
+	json.Unmarshal(got[0].Params.Result, &pooled)
+	if got[0].Params.Subscription != pending || pooled.ID != tx.ID() {
+		t.Errorf("Expected the pooled transaction first, got %+v", got[0])
+	}
+	json.Unmarshal(got[1].Params.Result, &seen)
+	if got[1].Params.Subscription != activity || seen.Status != "pending" {
+		t.Errorf("Expected pending activity, got %+v", got[1])
+	}
+	json.Unmarshal(got[2].Params.Result, &head.Result)
+	if got[2].Params.Subscription != heads || head.Result.Height != 1 {
+		t.Errorf("Expected the new head, got %+v", got[2])
+	}
+	json.Unmarshal(got[3].Params.Result, &seen)
+	if got[3].Params.Subscription != activity || seen.Status != "included" || seen.BlockHeight != 1 || seen.ID != tx.ID() {
+		t.Errorf("Expected included activity, got %+v", got[3])
+	}
+
+	var unsub struct{ Result bool }
+	json.Unmarshal(wsCall(t, c, fmt.Sprintf(`{"jsonrpc":"2.0","id":6,"method":"unsubscribe","params":{"id":%q}}`, heads)), &unsub)
+	if !unsub.Result {
+		t.Error("Expected unsubscribe to succeed")
+	}
+
+	api.Shutdown(context.Background())
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := c.ReadMessage(); err == nil {
+		t.Error("Expected the session to close on Shutdown")
+	}
+}
+
+func TestWebSocketRejectsPlainRequest(t *testing.T) {
+	srv := httptest.NewServer(NewServer(blockchain.NewBlockchain(), "").Handler())
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/ws")
+	if err != nil {
+		t.Fatalf("GET /ws failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 without upgrade, got %d", resp.StatusCode)
+	}
+}
+
+func TestWebSocketChecksOrigin(t *testing.T) {
+	s := NewServer(blockchain.NewBlockchain(), "")
+	s.SetControlOptions(ControlOptions{AllowedOrigins: []string{"https://explorer.example"}})
+	srv := httptest.NewServer(s.Handler())
+	defer srv.Close()
+	addr := strings.TrimPrefix(srv.URL, "http://")
+
+	if _, err := dialWebSocketFrom(addr, "/ws", "https://evil.example"); err == nil {
+		t.Error("Expected a cross-origin handshake to be refused")
+	}
+	for _, origin := range []string{"", "http://" + addr, "https://explorer.example"} {
+		c, err := dialWebSocketFrom(addr, "/ws", origin)
+		if err != nil {
+			t.Errorf("Expected origin %q to be allowed: %v", origin, err)
+			continue
+		}
+		c.Close()
+	}
+}
+
+func TestWebSocketRefusesControlMethods(t *testing.T) {
+	s := NewServer(blockchain.NewBlockchain(), "")
+	miner := &stubMiner{running: true}
+	s.SetMiningControl(miner)
+	srv := httptest.NewServer(s.Handler())
+	defer srv.Close()
+
+	// Loopback clients may stop mining over HTTP, never over /ws
+	c, err := dialWebSocket(strings.TrimPrefix(srv.URL, "http://"), "/ws")
+	if err != nil {
+		t.Fatalf("dialWebSocket failed: %v", err)
+	}
+	defer c.Close()
+	var resp RPCResponse
+	json.Unmarshal(wsCall(t, c, `{"jsonrpc":"2.0","method":"mining_stop","id":1}`), &resp)
+	if resp.Error == nil || resp.Error.Code != codeForbidden || !miner.running {
+		t.Errorf("Expected mining_stop over /ws to be forbidden, got %+v", resp.Error)
+	}
+}
@@ -0,0 +1,184 @@
+package blockchain
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// auditTolerance absorbs float rounding when summing balances
+const auditTolerance = 1e-6
+
+// AssetUNBT names the native coin in audit reports
+const AssetUNBT = "UNBT"
+
+// SupplyCheck compares the expected and actual supply of one asset
+type SupplyCheck struct {
+	Asset    string  // AssetUNBT or a token ID
+	Expected float64 // Genesis allocation plus rewards minus burns
+	Actual   float64 // Sum of balances
+}
+
+// OK reports whether the supply is conserved
+func (c SupplyCheck) OK() bool {
+	return math.Abs(c.Expected-c.Actual) <= auditTolerance
+}
+
+// AuditReport is the result of a supply audit
+type AuditReport struct {
+	Height     int
+	Minted     float64 // Genesis allocations plus block rewards, recomputed from blocks
+	Burned     float64 // Fees burned, recomputed from blocks
+	Checks     []SupplyCheck
+	Violations []string
+}
+
+// OK reports whether the audit found no violation
+func (r AuditReport) OK() bool {
+	return len(r.Violations) == 0
+}
+
+// supplyTotals is the sum of balances per asset, staked and unbonding UNBT included
+type supplyTotals struct {
+	UNBT   float64
+	Tokens map[string]float64
+}
+
+func (bc *Blockchain) supplyTotals() supplyTotals {
+	t := supplyTotals{Tokens: make(map[string]float64)}
+	for _, balance := range bc.Balances {
+		t.UNBT += balance
+	}
+	for _, staked := range bc.Stakes {
+		t.UNBT += staked
+	}
+	for _, unbonding := range bc.Unbonding {
+		for _, u := range unbonding {
+			t.UNBT += u.Amount
+		}
+	}
+	for tokenID, holders := range bc.TokenBalances {
+		for _, balance := range holders {
+			t.Tokens[tokenID] += balance
+		}
+	}
+	return t
+}
+
+// AuditChain verifies the fee and coinbase accounting of every block against the
+// emission schedule, then that current balances add up to genesis allocations plus
+// rewards minus burns, for UNBT and for every token
+func (bc *Blockchain) AuditChain() AuditReport {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	report := AuditReport{Height: len(bc.Chain) - 1}
+	violate := func(format string, args ...interface{}) {
+		report.Violations = append(report.Violations, fmt.Sprintf(format, args...))
+	}
+
+	for _, amount := range bc.Params.GenesisAlloc {
+		report.Minted += amount
+	}
+	for _, block := range bc.Chain[1:] {
+		feesCharged := 0.0
+		for _, receipt := range block.Receipts {
+			feesCharged += receipt.FeeCharged
+		}
+		fees := block.Fees
+		if math.Abs(feesCharged-fees.Total) > auditTolerance {
+			violate("block #%d: receipts charge %f UNBT in fees, block records %f", block.Index, feesCharged, fees.Total)
+		}
+		if math.Abs(fees.Miner+fees.Treasury+fees.Burned-fees.Total) > auditTolerance {
+			violate("block #%d: fee split %+v does not add up", block.Index, fees)
+		}
+
+		blockReward := 0.0
+		if len(block.Transactions) > 0 {
+			blockReward = bc.Params.rewardAt(block.Index, report.Minted)
+		}
+		paid := 0.0
+		for _, payout := range block.Rewards {
+			paid += payout.Amount
+		}
+		if math.Abs(paid-(blockReward+fees.Miner)) > auditTolerance {
+			violate("block #%d: coinbase pays %f UNBT, reward %f plus miner fees %f allow %f", block.Index, paid, blockReward, fees.Miner, blockReward+fees.Miner)
+		}
+		report.Minted += blockReward
+		report.Burned += fees.Burned
+	}
+
+	if math.Abs(report.Minted-bc.Minted) > auditTolerance {
+		violate("minted counter is %f UNBT, blocks add up to %f", bc.Minted, report.Minted)
+	}
+	if math.Abs(report.Burned-bc.Burned) > auditTolerance {
+		violate("burned counter is %f UNBT, blocks add up to %f", bc.Burned, report.Burned)
+	}
+
+	totals := bc.supplyTotals()
+	report.Checks = append(report.Checks, SupplyCheck{Asset: AssetUNBT, Expected: report.Minted - report.Burned, Actual: totals.UNBT})
+	expectedTokens := make(map[string]float64)
+	for tokenID, alloc := range bc.Params.GenesisTokens {
+		for _, amount := range alloc {
+			expectedTokens[tokenID] += amount
+		}
+	}
+	tokenIDs := make([]string, 0, len(expectedTokens))
+	for tokenID := range expectedTokens {
+		tokenIDs = append(tokenIDs, tokenID)
+	}
+	for tokenID := range totals.Tokens {
+		if _, ok := expectedTokens[tokenID]; !ok {
+			tokenIDs = append(tokenIDs, tokenID)
+		}
+	}
+	sort.Strings(tokenIDs)
+	for _, tokenID := range tokenIDs {
+		report.Checks = append(report.Checks, SupplyCheck{Asset: tokenID, Expected: expectedTokens[tokenID], Actual: totals.Tokens[tokenID]})
+	}
+	for _, check := range report.Checks {
+		if !check.OK() {
+			violate("%s supply is %f, expected %f", check.Asset, check.Actual, check.Expected)
+		}
+	}
+	return report
+}
+
+// checkBlockSupply verifies that applying a block changed the UNBT supply by
+// exactly the reward minus the burned fees and left every token supply unchanged
+func (bc *Blockchain) checkBlockSupply(block *Block, before supplyTotals, blockReward float64) error {
+	after := bc.supplyTotals()
+	expected := before.UNBT + blockReward - block.Fees.Burned
+	if math.Abs(after.UNBT-expected) > auditTolerance {
+		return fmt.Errorf("%w: block #%d leaves %f UNBT in balances, expected %f", ErrSupplyViolation, block.Index, after.UNBT, expected)
+	}
+	for tokenID, supply := range after.Tokens {
+		if math.Abs(supply-before.Tokens[tokenID]) > auditTolerance {
+			return fmt.Errorf("%w: block #%d changes %s supply from %f to %f", ErrSupplyViolation, block.Index, tokenID, before.Tokens[tokenID], supply)
+		}
+	}
+	return nil
+}
+
+// halt stops the chain from accepting blocks and transactions after a violation
+func (bc *Blockchain) halt(err error) {
+	if bc.haltErr != nil {
+		return
+	}
+	bc.haltErr = err
+	close(bc.haltCh)
+	bc.logs.audit.Error("Chain halted", "reason", err)
+	bc.events.publish(ChainHalted{Reason: err})
+}
+
+// Halted returns a channel closed when the chain halts on a supply violation
+func (bc *Blockchain) Halted() <-chan struct{} {
+	return bc.haltCh
+}
+
+// HaltError returns the violation that halted the chain, nil while it runs
+func (bc *Blockchain) HaltError() error {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.haltErr
+}
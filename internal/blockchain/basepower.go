@@ -0,0 +1,114 @@
+package blockchain
+
+import (
+	"time"
+	"unknownberrytrip/internal/transaction"
+)
+
+// bpPeriod is the time over which an address regenerates its full daily BasePower
+const bpPeriod = 24 * 3600
+
+// maxFutureBlockTime bounds how far ahead of the local clock a block timestamp
+// may be, so miners cannot regenerate BasePower early
+const maxFutureBlockTime = 2 * time.Hour
+
+// regenerateBasePower returns the BasePower of an address at time at, given what it
+// held at lastUpdate, and the new update time. BasePower accrues linearly at
+// capacity per day, including partial days, and never exceeds capacity. The update
+// time only advances by the time that produced whole BasePower, so no accrual is lost.
+func regenerateBasePower(bp int, lastUpdate, at int64, capacity int) (int, int64) {
+	if capacity <= 0 {
+		return 0, at
+	}
+	elapsed := at - lastUpdate
+	if elapsed <= 0 {
+		if bp > capacity {
+			bp = capacity
+		}
+		return bp, lastUpdate
+	}
+	accrued := elapsed * int64(capacity) / bpPeriod
+	if int64(bp)+accrued >= int64(capacity) {
+		return capacity, at
+	}
+	return bp + int(accrued), lastUpdate + accrued*bpPeriod/int64(capacity)
+}
+
+// basePowerAt returns the BasePower of address at time at without touching state.
+// Addresses seen for the first time start with full capacity.
+func (bc *Blockchain) basePowerAt(address string, at int64) (int, int64) {
+	capacity := bc.basePowerCapacity(address)
+	lastUpdate, ok := bc.LastBPUpdate[address]
+	if !ok {
+		return capacity, at
+	}
+	return regenerateBasePower(bc.BasePower[address], lastUpdate, at, capacity)
+}
+
+// updateBasePower regenerates BP for address up to the block timestamp at
+func (bc *Blockchain) updateBasePower(address string, at int64) {
+	bc.BasePower[address], bc.LastBPUpdate[address] = bc.basePowerAt(address, at)
+}
+
+// txCost returns the BasePower a transaction consumes and the UNBT fee it pays
+// when bp BasePower is available. BasePower covers the base fee when enough is
+// left, otherwise the base fee is paid in UNBT. ExtraPower is always paid in UNBT.
+func txCost(tx transaction.Transaction, bp int) (int, float64) {
+	requiredPower := baseUNBTpower // 1 BP for UNBT
+	fallback := baseFee            // 0.001 UNBT for UNBT
+	if tx.IsTokenTransfer {
+		requiredPower = baseTokenPower                    // 10 BP for tokens
+		fallback = float64(baseTokenPower) / powerPerUNBT // 0.01 UNBT for tokens
+	}
+	used, fee := 0, 0.0
+	if bp >= requiredPower {
+		used = requiredPower
+	} else {
+		fee = fallback
+	}
+	if tx.ExtraPower > 0 {
+		fee += float64(tx.ExtraPower) * extraPowerCost
+	}
+	return used, fee
+}
+
+// pendingCosts charges the pooled transactions involving address the way block
+// execution at time at would, returning the BasePower address has left afterwards
+// and the UNBT it committed to amounts and to the fees it pays, its own or
+// sponsored. Fees are charged in pool order, which matches mining order for the
+// transactions of one sender.
+func (bc *Blockchain) pendingCosts(address string, at int64) (int, float64) {
+	bp, _ := bc.basePowerAt(address, at)
+	committed := 0.0
+	pooled := bc.pooled(address)
+	for _, tx := range pooled.paid {
+		used, fee := txCost(tx, bp)
+		bp -= used
+		committed += fee
+	}
+	for _, tx := range pooled.sent {
+		if spendsAmount(tx) {
+			committed += tx.Amount
+		}
+	}
+	return bp, committed
+}
+
+// nextBlockTime returns the timestamp the next block is built with: the local
+// clock, but never before the tip
+func (bc *Blockchain) nextBlockTime() int64 {
+	now := time.Now().Unix()
+	if tip := bc.Chain[len(bc.Chain)-1].Timestamp; now < tip {
+		return tip
+	}
+	return now
+}
+
+// GetBasePower returns the BasePower address would have in the next block, after
+// its pooled transactions are charged
+func (bc *Blockchain) GetBasePower(address string) int {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	bp, _ := bc.pendingCosts(address, bc.nextBlockTime())
+	return bp
+}
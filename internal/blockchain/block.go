@@ -2,6 +2,7 @@ package blockchain
 
 import (
 	"crypto/sha256"
+	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
 	"unknownberrytrip/internal/transaction"
@@ -16,19 +17,52 @@ type Block struct {
 	Hash         string
 	Nonce        int
 	Miner        string
+	Coinbase     []Payout   // Split of the block reward, empty to pay it all to Miner
+	Receipts     []Receipt  // Execution results, not covered by the hash
+	Rewards      []Payout   // Coinbase payouts made, not covered by the hash
+	Fees         FeeSummary // Fees collected and where they went, not covered by the hash
+	Unbonded     []Payout   // Unbonding UNBT released before the transactions, not covered by the hash
+}
+
+// Payout is an amount of UNBT credited to an address by the block itself
+type Payout struct {
+	Address string
+	Amount  float64
 }
 
 // CalculateHash computes the hash of the block
 func (b *Block) CalculateHash() string {
-	record, _ := json.Marshal(struct {
-		Index        int
-		Timestamp    int64
-		Transactions []transaction.Transaction
-		PrevHash     string
-		Nonce        int
-		Miner        string
-	}{b.Index, b.Timestamp, b.Transactions, b.PrevHash, b.Nonce, b.Miner})
+	sum := hashHeader(b.headerPrefix(), uint64(b.Nonce))
+	return hex.EncodeToString(sum[:])
+}
+
+// TxRoot commits to the transactions of the block through their IDs
+func (b *Block) TxRoot() string {
 	h := sha256.New()
-	h.Write(record)
+	for i := range b.Transactions {
+		h.Write([]byte(b.Transactions[i].ID()))
+	}
 	return hex.EncodeToString(h.Sum(nil))
 }
+
+// headerPrefix serializes every header field except the nonce, which is appended
+// by hashHeader. Miners build it once per block and only vary the nonce.
+func (b *Block) headerPrefix() []byte {
+	record, _ := json.Marshal(struct {
+		Index     int
+		Timestamp int64
+		TxRoot    string
+		PrevHash  string
+		Miner     string
+		Coinbase  []Payout
+	}{b.Index, b.Timestamp, b.TxRoot(), b.PrevHash, b.Miner, b.Coinbase})
+	return record
+}
+
+// hashHeader hashes a header prefix followed by the big-endian nonce
+func hashHeader(prefix []byte, nonce uint64) [32]byte {
+	buf := make([]byte, len(prefix)+8)
+	copy(buf, prefix)
+	binary.BigEndian.PutUint64(buf[len(prefix):], nonce)
+	return sha256.Sum256(buf)
+}
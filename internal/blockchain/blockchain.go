@@ -1,53 +1,151 @@
 package blockchain
 
 import (
+	"context"
 	"fmt"
 	"math"
-	"sort"
 	"sync"
 	"time"
+	"unknownberrytrip/internal/logging"
 	"unknownberrytrip/internal/transaction"
 )
 
-const reward = 10.0          // Base block reward in UNBT
-const baseFee = 0.001        // Minimum fee in UNBT for regular transactions
-const powerPerUNBT = 1000    // 0.001 UNBT = 1 Power
-const baseTokenPower = 10    // Base cost for token transfer in Power
-const dailyBP = 100          // 100 BP per day per address
-const baseUNBTpower = 1      // 1 BP for regular UNBT transaction
-const extraPowerCost = 0.001 // 0.001 UNBT per 1 Extra Power
+const reward = 10.0            // Default initial block reward in UNBT
+const baseFee = 0.001          // Minimum fee in UNBT for regular transactions
+const powerPerUNBT = 1000      // 0.001 UNBT = 1 Power
+const baseTokenPower = 10      // Base cost for token transfer in Power
+const dailyBP = 100            // 100 BP per day per address
+const baseUNBTpower = 1        // 1 BP for regular UNBT transaction
+const extraPowerCost = 0.001   // 0.001 UNBT per 1 Extra Power
+const coinbaseTolerance = 1e-9 // Rounding allowed when a coinbase splits the reward
 
 // Blockchain is a chain of blocks
 type Blockchain struct {
 	Chain           []*Block
-	Balances        map[string]float64        // Balance in UNBT
-	Nonces          map[string]int            // Nonce for transaction ordering
-	BasePower       map[string]int            // BasePower for addresses
-	LastBPUpdate    map[string]int64          // Time of last BP update
-	TransactionPool []transaction.Transaction // Transaction pool
-	Miners          map[string]int            // Miner transaction counter in current block
-	mu              sync.Mutex
+	Balances        map[string]float64               // Balance in UNBT
+	TokenBalances   map[string]map[string]float64    // Token balances by token ID, then address
+	Nonces          map[string]int                   // Nonce for transaction ordering
+	BasePower       map[string]int                   // BasePower for addresses
+	LastBPUpdate    map[string]int64                 // Block timestamp BP was last regenerated at
+	Stakes          map[string]float64               // UNBT staked for BasePower
+	Unbonding       map[string][]Unbonding           // Unstaked UNBT waiting for release
+	Delegations     map[string]map[string]Delegation // BasePower capacity lent, by delegator then delegatee
+	TransactionPool []transaction.Transaction        // Transaction pool
+	Minted          float64                          // UNBT created by genesis allocations and block rewards
+	Burned          float64                          // UNBT destroyed by fee burning
+	Params          ChainParams                      // Consensus parameters
+	AssertSupply    bool                             // Audit supply after every block and halt on violation
+	txIndex         map[string]TxLocation            // Location of included transactions by ID
+	poolIndex       map[string]int                   // Position in TransactionPool of pooled transactions by ID
+	poolAccounts    map[string]*poolAccount          // Pooled transactions by sender and fee payer
+	blockHeights    map[string]int                   // Height of blocks by hash
+	history         map[string][]HistoryEntry        // Activity by address, oldest first
+	dropped         map[string]droppedTx             // Transactions removed from the pool unmined, by ID
+	droppedOrder    []string                         // Dropped transaction IDs, oldest first
+	historyHeight   int                              // Last block height covered by history
+	tipCh           chan struct{}                    // Closed and replaced when a block is added
+	pow             *Miner                           // Proof of Work miner for new blocks
+	templates       map[string]*Block                // Unmined blocks handed out as templates
+	templateOrder   []string                         // Template IDs, oldest first
+	templateCache   map[string]*BlockTemplate        // Templates without a coinbase split by miner, for the current tip
+	haltCh          chan struct{}                    // Closed when the chain halts
+	haltErr         error                            // Violation that halted the chain
+	events          *eventBus                        // Subscribers to chain events
+	logs            loggers                          // Loggers of the chain components
+	mu              sync.RWMutex                     // Readers share the lock; block building, import and the pool write
 }
 
-// NewBlockchain creates a new blockchain with a genesis block
+// NewBlockchain creates a new blockchain with a genesis block and default parameters
 func NewBlockchain() *Blockchain {
+	return NewBlockchainWithParams(DefaultChainParams())
+}
+
+// NewBlockchainWithParams creates a new blockchain with a genesis block
+func NewBlockchainWithParams(params ChainParams) *Blockchain {
 	genesisBlock := NewGenesisBlock()
 	bc := &Blockchain{
 		Chain:           []*Block{genesisBlock},
 		Balances:        make(map[string]float64),
+		TokenBalances:   make(map[string]map[string]float64),
 		Nonces:          make(map[string]int),
 		BasePower:       make(map[string]int),
 		LastBPUpdate:    make(map[string]int64),
+		Stakes:          make(map[string]float64),
+		Unbonding:       make(map[string][]Unbonding),
+		Delegations:     make(map[string]map[string]Delegation),
 		TransactionPool: []transaction.Transaction{},
-		Miners:          make(map[string]int),
+		Params:          params,
+	}
+	bc.init()
+	for address, amount := range params.GenesisAlloc {
+		bc.Balances[address] = amount
+		bc.Nonces[address] = 0
+		bc.BasePower[address] = dailyBP
+		bc.LastBPUpdate[address] = genesisBlock.Timestamp
+		bc.Minted += amount
+	}
+	for tokenID, alloc := range params.GenesisTokens {
+		for address, amount := range alloc {
+			bc.creditTokens(tokenID, address, amount)
+		}
 	}
-	bc.Balances[genesisBlock.Miner] = reward
-	bc.Nonces[genesisBlock.Miner] = 0
-	bc.BasePower[genesisBlock.Miner] = dailyBP
-	bc.LastBPUpdate[genesisBlock.Miner] = time.Now().Unix()
 	return bc
 }
 
+// init creates the indexes and runtime fields that are not persisted
+func (bc *Blockchain) init() {
+	bc.txIndex = make(map[string]TxLocation)
+	bc.blockHeights = map[string]int{bc.Chain[0].Hash: 0}
+	bc.history = make(map[string][]HistoryEntry)
+	bc.historyHeight = 0
+	bc.dropped = make(map[string]droppedTx)
+	bc.droppedOrder = nil
+	bc.indexPool()
+	bc.tipCh = make(chan struct{})
+	bc.haltCh = make(chan struct{})
+	bc.events = newEventBus()
+	bc.pow = NewMiner(0)
+	bc.SetLogger(logging.Default())
+	bc.clearTemplates()
+}
+
+// loggers are the component loggers of a blockchain
+type loggers struct {
+	chain  *logging.Logger // Block building, import and storage
+	pool   *logging.Logger // Transaction pool admission
+	mining *logging.Logger // Mining loop and block templates
+	audit  *logging.Logger // Supply audit
+}
+
+// SetLogger makes the chain and its miner log to l under the chain, pool, mining,
+// pow and audit components. Call it before the chain is shared between goroutines.
+func (bc *Blockchain) SetLogger(l *logging.Logger) {
+	bc.logs = loggers{
+		chain:  l.Component("chain"),
+		pool:   l.Component("pool"),
+		mining: l.Component("mining"),
+		audit:  l.Component("audit"),
+	}
+	bc.pow.SetLogger(l.Component("pow"))
+}
+
+// TipChanged returns a channel closed when the next block is added
+func (bc *Blockchain) TipChanged() <-chan struct{} {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.tipCh
+}
+
+// Hashrate returns the hashes per second of the last block mined by this node
+func (bc *Blockchain) Hashrate() float64 {
+	return bc.pow.Hashrate()
+}
+
+// TotalHashes returns the number of hashes computed by this node's miner
+func (bc *Blockchain) TotalHashes() uint64 {
+	return bc.pow.TotalHashes()
+}
+
 // NewGenesisBlock creates a genesis block
 func NewGenesisBlock() *Block {
 	block := &Block{
@@ -62,39 +160,15 @@ func NewGenesisBlock() *Block {
 	return block
 }
 
-// updateBasePower updates BP for address
-func (bc *Blockchain) updateBasePower(address string) {
-	now := time.Now().Unix()
-	lastUpdate, exists := bc.LastBPUpdate[address]
-	if !exists {
-		bc.BasePower[address] = dailyBP
-		bc.LastBPUpdate[address] = now
-		return
-	}
-	daysPassed := float64(now-lastUpdate) / (24 * 3600)
-	if daysPassed >= 1 {
-		bc.BasePower[address] = int(math.Min(float64(bc.BasePower[address])+dailyBP*daysPassed, dailyBP))
-		bc.LastBPUpdate[address] = now
-	}
-}
-
-// calculatePendingBalance calculates available balance considering transactions in the pool
-func (bc *Blockchain) calculatePendingBalance(address string) float64 {
-	pendingCost := 0.0
-	for _, tx := range bc.TransactionPool {
-		if tx.From == address {
-			pendingCost += tx.Amount
-			if tx.IsTokenTransfer && bc.BasePower[address] < baseTokenPower {
-				pendingCost += float64(baseTokenPower) / powerPerUNBT
-			} else if !tx.IsTokenTransfer && bc.BasePower[address] < baseUNBTpower {
-				pendingCost += baseFee
-			}
-			if tx.ExtraPower > 0 {
-				pendingCost += float64(tx.ExtraPower) * extraPowerCost
-			}
+// calculatePendingTokenBalance calculates available token balance considering transactions in the pool
+func (bc *Blockchain) calculatePendingTokenBalance(address, tokenID string) float64 {
+	pending := 0.0
+	for _, tx := range bc.pooled(address).sent {
+		if tx.IsTokenTransfer && tx.TokenID == tokenID {
+			pending += tx.Amount
 		}
 	}
-	return bc.Balances[address] - pendingCost
+	return bc.TokenBalances[tokenID][address] - pending
 }
 
 // AddTransactionToPool adds a transaction to the pool
@@ -102,161 +176,503 @@ func (bc *Blockchain) AddTransactionToPool(tx transaction.Transaction) error {
 	bc.mu.Lock()
 	defer bc.mu.Unlock()
 
-	fmt.Printf("[Pool] Attempting to add transaction from %s to %s, amount: %f, nonce: %d, extraPower: %d, isToken: %t\n", tx.From, tx.To, tx.Amount, tx.Nonce, tx.ExtraPower, tx.IsTokenTransfer)
-	if !transaction.VerifyTxSignature(&tx) {
-		fmt.Println("[Pool] Invalid signature")
-		return fmt.Errorf("invalid signature")
+	if err := bc.checkTransaction(tx, true); err != nil {
+		bc.logs.pool.Info("Transaction rejected", "id", tx.ID(), "from", tx.From, "reason", err)
+		bc.events.publish(TxRejected{ID: tx.ID(), Tx: &tx, Reason: err})
+		return err
 	}
+	bc.poolIndex[tx.ID()] = len(bc.TransactionPool)
+	bc.TransactionPool = append(bc.TransactionPool, tx)
+	bc.addPoolAccounts(tx)
+	bc.logs.pool.Debug("Transaction accepted", "id", tx.ID(), "from", tx.From, "nonce", tx.Nonce, "pool_size", len(bc.TransactionPool))
+	bc.events.publish(TxAccepted{ID: tx.ID(), Tx: &tx, PoolSize: len(bc.TransactionPool)})
+	return nil
+}
 
-	// Get current nonce, if address doesn't exist — consider it 0
-	currentNonce, exists := bc.Nonces[tx.From]
-	if !exists {
-		currentNonce = 0
+// checkTransaction checks tx against the state and the pool as pool admission
+// does, the signature only when verifySignature is set; the caller holds bc.mu
+func (bc *Blockchain) checkTransaction(tx transaction.Transaction, verifySignature bool) error {
+	if bc.haltErr != nil {
+		return ErrHalted
 	}
-	expectedNonce := currentNonce // Expect current nonce, not +1
-	if tx.Nonce != expectedNonce {
-		fmt.Printf("[Pool] Invalid nonce: expected %d, got %d\n", expectedNonce, tx.Nonce)
-		return fmt.Errorf("invalid nonce")
+	bc.logs.pool.Debug("Checking transaction", "from", tx.From, "to", tx.To, "amount", tx.Amount, "nonce", tx.Nonce, "extra_power", tx.ExtraPower, "token", tx.TokenID)
+	if verifySignature && !transaction.VerifyTxSignature(&tx) {
+		return ErrInvalidSignature
 	}
 
-	bc.updateBasePower(tx.From)
-	requiredPower := baseUNBTpower // 1 BP for UNBT
-	if tx.IsTokenTransfer {
-		requiredPower = baseTokenPower // 10 BP for tokens
+	if err := checkTxType(tx); err != nil {
+		return err
 	}
 
-	totalCost := 0.0
-	if bc.BasePower[tx.From] >= requiredPower {
-		bc.BasePower[tx.From] -= requiredPower
-		fmt.Printf("[Pool] Used %d BasePower, remaining: %d\n", requiredPower, bc.BasePower[tx.From])
-	} else {
-		if tx.IsTokenTransfer {
-			totalCost = float64(requiredPower) / powerPerUNBT // 0.01 UNBT for tokens
-		} else {
-			totalCost = baseFee // 0.001 UNBT for UNBT
+	// Confirmed nonce plus transactions of the sender already waiting in the pool
+	expectedNonce := bc.pendingNonce(tx.From)
+	if tx.Nonce != expectedNonce {
+		bc.logs.pool.Debug("Invalid nonce", "from", tx.From, "expected", expectedNonce, "got", tx.Nonce)
+		details := map[string]interface{}{"expected": expectedNonce, "got": tx.Nonce}
+		if tx.Nonce < expectedNonce {
+			return rejectTx(ErrNonceTooLow, details, "nonce too low: expected %d, got %d", expectedNonce, tx.Nonce)
 		}
-		fmt.Printf("[Pool] Insufficient BasePower, using %f UNBT instead\n", totalCost)
+		return rejectTx(ErrNonceGap, details, "nonce gap: expected %d, got %d", expectedNonce, tx.Nonce)
 	}
 
-	// Consider Extra Power
-	extraPowerCostTotal := float64(tx.ExtraPower) * extraPowerCost
-	if extraPowerCostTotal > 0 {
-		totalCost += extraPowerCostTotal
-		fmt.Printf("[Pool] Added %f UNBT for %d ExtraPower\n", extraPowerCostTotal, tx.ExtraPower)
+	// Charge the transaction after the pooled ones, as the next block would. The
+	// payer covers the fee, the sender the amount; they are the same unless sponsored.
+	at := bc.nextBlockTime()
+	payer := tx.Payer()
+	bp, committed := bc.pendingCosts(payer, at)
+	usedPower, totalCost := txCost(tx, bp)
+	if usedPower > 0 {
+		bc.logs.pool.Debug("Paying with BasePower", "payer", payer, "used", usedPower, "remaining", bp-usedPower)
+	} else {
+		bc.logs.pool.Debug("Insufficient BasePower, paying UNBT", "payer", payer, "base_power", bp, "fee", totalCost)
 	}
 
-	pendingBalance := bc.calculatePendingBalance(tx.From)
-	if pendingBalance < tx.Amount+totalCost {
-		fmt.Printf("[Pool] Insufficient balance: need %f UNBT (amount + fee), have %f after pending\n", tx.Amount+totalCost, pendingBalance)
-		return fmt.Errorf("insufficient balance")
+	payerBalance := bc.Balances[payer] - committed
+	if payerBalance < totalCost {
+		bc.logs.pool.Debug("Insufficient balance for fee", "payer", payer, "fee", totalCost, "available", payerBalance)
+		return rejectTx(ErrInsufficientBalance, map[string]interface{}{"address": payer, "required": totalCost, "available": payerBalance},
+			"insufficient balance for fee: need %g UNBT, have %g", totalCost, payerBalance)
+	}
+	senderBalance := payerBalance - totalCost
+	if payer != tx.From {
+		_, senderCommitted := bc.pendingCosts(tx.From, at)
+		senderBalance = bc.Balances[tx.From] - senderCommitted
 	}
 
-	bc.TransactionPool = append(bc.TransactionPool, tx)
-	fmt.Printf("[Pool] Transaction added to pool, pool size: %d\n", len(bc.TransactionPool))
+	switch {
+	case tx.IsTokenTransfer:
+		pendingTokens := bc.calculatePendingTokenBalance(tx.From, tx.TokenID)
+		if pendingTokens < tx.Amount {
+			bc.logs.pool.Debug("Insufficient token balance", "from", tx.From, "token", tx.TokenID, "amount", tx.Amount, "available", pendingTokens)
+			return rejectTx(ErrInsufficientTokenBalance, map[string]interface{}{"address": tx.From, "token": tx.TokenID, "required": tx.Amount, "available": pendingTokens},
+				"insufficient token balance: need %g %s, have %g", tx.Amount, tx.TokenID, pendingTokens)
+		}
+	case !spendsAmount(tx):
+		var err error
+		if tx.Type == transaction.TxUnstake {
+			err = bc.checkUnstake(tx.From, tx.Amount, bc.pendingUnstake(tx.From))
+		} else {
+			err = bc.checkDelegation(tx, len(bc.Chain), bc.pendingDelegated(tx.From))
+		}
+		if err != nil {
+			return err
+		}
+	case senderBalance < tx.Amount:
+		bc.logs.pool.Debug("Insufficient balance for amount", "from", tx.From, "amount", tx.Amount, "available", senderBalance)
+		return rejectTx(ErrInsufficientBalance, map[string]interface{}{"address": tx.From, "required": tx.Amount, "available": senderBalance},
+			"insufficient balance for amount: need %g UNBT, have %g", tx.Amount, senderBalance)
+	}
 
-	// Increment nonce only after successful addition
-	bc.Nonces[tx.From] = expectedNonce + 1
 	return nil
 }
 
-// AddBlock adds a new block to the blockchain
+// PendingTransactions returns a copy of the pool in the order it is mined:
+// highest ExtraPower first, each sender in nonce order
+func (bc *Blockchain) PendingTransactions() []transaction.Transaction {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return orderByPriority(bc.TransactionPool)
+}
+
+// pendingNonce returns the next nonce expected from address, counting pooled transactions
+func (bc *Blockchain) pendingNonce(address string) int {
+	nonce := bc.Nonces[address]
+	for _, tx := range bc.TransactionPool {
+		if tx.From == address {
+			nonce++
+		}
+	}
+	return nonce
+}
+
+// AddBlock executes the transactions and appends a new block with their receipts.
+// Transactions with a bad signature or nonce are skipped; transactions that fail
+// execution are kept with a failed receipt unless Params.IncludeFailedTxs is false.
 func (bc *Blockchain) AddBlock(transactions []transaction.Transaction, miner string) {
+	bc.AddBlockContext(context.Background(), transactions, miner)
+}
+
+// AddBlockContext is AddBlock with a cancellable Proof of Work. The block is mined
+// without holding the chain lock; mining is abandoned when ctx is done or another
+// block becomes the tip first, and the error is returned with state untouched.
+// Processed transactions are removed from the pool once the block is added; those
+// left out because the block is full stay.
+func (bc *Blockchain) AddBlockContext(ctx context.Context, transactions []transaction.Transaction, miner string) error {
+	block, processed, _, tipChanged := bc.buildBlock(transactions, miner)
+
+	mineCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	go func() {
+		select {
+		case <-tipChanged:
+			cancel(ErrStaleBlock)
+		case <-mineCtx.Done():
+		}
+	}()
+	if err := bc.pow.Mine(mineCtx, block); err != nil {
+		bc.logs.chain.Info("Block abandoned", "height", block.Index, "reason", err)
+		return err
+	}
+	return bc.importBlock(block, processed)
+}
+
+// buildBlock selects the transactions that can go into the next block and returns
+// it unmined, with the transactions it processed before filling up, the fees it
+// collects and a channel closed when the tip changes. Transactions with a bad
+// signature or nonce are skipped, as are failed ones unless Params.IncludeFailedTxs.
+func (bc *Blockchain) buildBlock(transactions []transaction.Transaction, miner string) (*Block, []transaction.Transaction, float64, <-chan struct{}) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	prevBlock := bc.Chain[len(bc.Chain)-1]
+	bc.logs.chain.Debug("Building block", "height", prevBlock.Index+1, "prev_hash", prevBlock.Hash, "candidates", len(transactions))
+
+	// Execute against a scratch copy of the state to find what fits
+	block := createBlock(nil, prevBlock, miner)
+	block.Timestamp = bc.nextBlockTime()
+	scratch := bc.scratch()
+	scratch.releaseUnbonded(block.Index)
+	scratch.expireDelegations(block)
+	var included []transaction.Transaction
+	fees := 0.0
+	processed := transactions
+	for i, tx := range transactions {
+		if max := bc.Params.MaxBlockTxs; max > 0 && len(included) == max {
+			bc.logs.chain.Debug("Block full", "txs", max, "left", len(transactions)-i)
+			processed = transactions[:i]
+			break
+		}
+		if !transaction.VerifyTxSignature(&tx) {
+			bc.logs.chain.Debug("Skipping transaction", "index", i, "reason", "invalid signature")
+			continue
+		}
+		if err := checkTxType(tx); err != nil {
+			bc.logs.chain.Debug("Skipping transaction", "index", i, "reason", err)
+			continue
+		}
+		if tx.Nonce != scratch.Nonces[tx.From] {
+			bc.logs.chain.Debug("Skipping transaction", "index", i, "reason", "invalid nonce", "expected", scratch.Nonces[tx.From], "got", tx.Nonce)
+			continue
+		}
+		receipt, ok := scratch.applyTransaction(tx, block)
+		if !ok {
+			bc.logs.chain.Debug("Dropping failed transaction", "index", i, "reason", receipt.Reason)
+			continue
+		}
+		scratch.Nonces[tx.From]++
+		included = append(included, tx)
+		fees += receipt.FeeCharged
+	}
+
+	block.Transactions = included
+	return block, processed, fees, bc.tipCh
+}
+
+// importBlock validates a mined block against the tip, executes it and appends it.
+// On any error the state is left as it was.
+func (bc *Blockchain) importBlock(block *Block, processed []transaction.Transaction) error {
 	bc.mu.Lock()
 	defer bc.mu.Unlock()
 
-	fmt.Println("[AddBlock:1] Starting block addition...")
-	fmt.Printf("[AddBlock:2] Number of transactions to process: %d\n", len(transactions))
+	if err := bc.connectBlock(block, processed); err != nil {
+		bc.events.publish(BlockRejected{Block: block, Reason: err})
+		return err
+	}
+	bc.events.publish(BlockImported{Block: block, Head: bc.headLocked()})
+	return nil
+}
+
+// connectBlock validates and appends a block; the caller holds bc.mu
+func (bc *Blockchain) connectBlock(block *Block, processed []transaction.Transaction) error {
+	if bc.haltErr != nil {
+		return ErrHalted
+	}
 	prevBlock := bc.Chain[len(bc.Chain)-1]
-	fmt.Printf("[AddBlock:3] Previous block index: %d, hash: %s\n", prevBlock.Index, prevBlock.Hash)
-	newBlock := NewBlock(transactions, prevBlock, miner)
-	fmt.Printf("[AddBlock:4] New block created with index: %d, hash: %s\n", newBlock.Index, newBlock.Hash)
+	if block.PrevHash != prevBlock.Hash || block.Index != prevBlock.Index+1 {
+		return ErrStaleBlock
+	}
+	if block.Timestamp < prevBlock.Timestamp {
+		return fmt.Errorf("%w: before previous block", ErrInvalidTimestamp)
+	}
+	if block.Timestamp > time.Now().Add(maxFutureBlockTime).Unix() {
+		return fmt.Errorf("%w: too far in the future", ErrInvalidTimestamp)
+	}
+	if !block.HasValidProof() {
+		return ErrInvalidProof
+	}
 
-	bc.Miners = make(map[string]int)
-	for i, tx := range transactions {
-		fmt.Printf("[AddBlock:5] Processing tx #%d: %s -> %s, amount: %f, isToken: %t\n", i, tx.From, tx.To, tx.Amount, tx.IsTokenTransfer)
-		bc.updateBasePower(tx.From)
-		totalCost := 0.0
-		// BP already written in AddTransactionToPool, here only UNBT
-		if tx.IsTokenTransfer && bc.BasePower[tx.From] < baseTokenPower {
-			totalCost = float64(baseTokenPower) / powerPerUNBT
-		} else if !tx.IsTokenTransfer && bc.BasePower[tx.From] < baseUNBTpower {
-			totalCost = baseFee
+	snapshot := bc.snapshotState()
+	var before supplyTotals
+	if bc.AssertSupply {
+		before = bc.supplyTotals()
+	}
+	receipts, err := bc.executeBlock(block)
+	if err != nil {
+		bc.restoreState(snapshot)
+		bc.logs.chain.Warn("Block rejected", "height", block.Index, "hash", block.Hash, "reason", err)
+		return err
+	}
+	totalFees := 0.0
+	for _, receipt := range receipts {
+		totalFees += receipt.FeeCharged
+	}
+	fees := bc.splitFees(totalFees)
+	rewards, err := bc.payCoinbase(block, fees.Miner)
+	if err != nil {
+		bc.restoreState(snapshot)
+		bc.logs.chain.Warn("Block rejected", "height", block.Index, "hash", block.Hash, "reason", err)
+		return err
+	}
+	bc.payFees(fees)
+	block.Receipts = receipts
+	block.Rewards = rewards
+	block.Fees = fees
+	if bc.AssertSupply {
+		blockReward := 0.0
+		if len(block.Transactions) > 0 {
+			blockReward = bc.Params.rewardAt(block.Index, snapshot.Minted)
 		}
-		if tx.ExtraPower > 0 {
-			totalCost += float64(tx.ExtraPower) * extraPowerCost
+		if err := bc.checkBlockSupply(block, before, blockReward); err != nil {
+			bc.restoreState(snapshot)
+			bc.halt(err)
+			return err
 		}
-		if totalCost > 0 {
-			if bc.Balances[tx.From] < totalCost {
-				fmt.Printf("[AddBlock:6] Insufficient balance for fee %f UNBT from %s\n", totalCost, tx.From)
-				continue
+	}
+
+	bc.Chain = append(bc.Chain, block)
+	bc.indexBlock(block)
+	bc.removeFromPool(block, processed)
+	close(bc.tipCh)
+	bc.tipCh = make(chan struct{})
+	bc.clearTemplates()
+	bc.logs.chain.Info("Block imported", "height", block.Index, "hash", block.Hash, "txs", len(block.Transactions), "pool_size", len(bc.TransactionPool))
+	return nil
+}
+
+// executeBlock releases matured unbonding UNBT, ends expired delegations, applies
+// every transaction of a block to the state and returns the receipts. A transaction
+// with a bad signature or nonce, or a failed one when failed transactions are not
+// allowed, makes the whole block invalid, as does exceeding Params.MaxBlockTxs.
+func (bc *Blockchain) executeBlock(block *Block) ([]Receipt, error) {
+	if max := bc.Params.MaxBlockTxs; max > 0 && len(block.Transactions) > max {
+		return nil, fmt.Errorf("block holds %d transactions, limit is %d", len(block.Transactions), max)
+	}
+	block.Unbonded = bc.releaseUnbonded(block.Index)
+	bc.expireDelegations(block)
+	receipts := make([]Receipt, 0, len(block.Transactions))
+	for i, tx := range block.Transactions {
+		bc.logs.chain.Debug("Executing transaction", "index", i, "from", tx.From, "to", tx.To, "amount", tx.Amount, "token", tx.TokenID)
+		if !transaction.VerifyTxSignature(&tx) {
+			return nil, fmt.Errorf("tx #%d: %w", i, ErrInvalidSignature)
+		}
+		if err := checkTxType(tx); err != nil {
+			return nil, fmt.Errorf("tx #%d: %w", i, err)
+		}
+		if expected := bc.Nonces[tx.From]; tx.Nonce != expected {
+			reason := ErrNonceGap
+			if tx.Nonce < expected {
+				reason = ErrNonceTooLow
 			}
-			bc.Balances[tx.From] -= totalCost
-			fmt.Printf("[AddBlock:6] Deducted fee %f UNBT from %s\n", totalCost, tx.From)
+			return nil, fmt.Errorf("tx #%d: %w: expected %d, got %d", i, reason, expected, tx.Nonce)
+		}
+		receipt, ok := bc.applyTransaction(tx, block)
+		if !ok {
+			return nil, fmt.Errorf("tx #%d: failed transactions are not allowed: %s", i, receipt.Reason)
 		}
+		receipt.BlockHeight = block.Index
+		receipt.Index = i
+		receipts = append(receipts, receipt)
+		bc.Nonces[tx.From]++
+	}
+	return receipts, nil
+}
 
-		if bc.Balances[tx.From] < tx.Amount {
-			fmt.Printf("[AddBlock:7] Insufficient balance for amount %f UNBT from %s\n", tx.Amount, tx.From)
-			continue
+// payCoinbase credits the block reward plus the miners' share of fees as split by
+// the block coinbase, or entirely to the block miner when the coinbase is empty.
+// Blocks without transactions earn nothing. The coinbase must pay out exactly the
+// reward of the emission schedule plus minerFees.
+func (bc *Blockchain) payCoinbase(block *Block, minerFees float64) ([]Payout, error) {
+	blockReward := 0.0
+	if len(block.Transactions) > 0 {
+		blockReward = bc.blockReward(block.Index)
+	}
+	value := blockReward + minerFees
+	if value == 0 {
+		if len(block.Coinbase) > 0 {
+			return nil, fmt.Errorf("%w: block earns nothing", ErrInvalidCoinbase)
 		}
-		bc.Balances[tx.From] -= tx.Amount
-		fmt.Printf("[AddBlock:7] Deducted amount %f UNBT from %s, new balance: %f\n", tx.Amount, tx.From, bc.Balances[tx.From])
-		if _, ok := bc.Balances[tx.To]; !ok {
-			bc.Balances[tx.To] = 0
-			fmt.Printf("[AddBlock:8] Initialized balance for %s to 0\n", tx.To)
+		return nil, nil
+	}
+
+	payouts := block.Coinbase
+	if len(payouts) == 0 {
+		payouts = []Payout{{Address: block.Miner, Amount: value}}
+	}
+	total := 0.0
+	for _, payout := range payouts {
+		if payout.Amount < 0 || payout.Address == "" {
+			return nil, fmt.Errorf("%w: invalid payout %+v", ErrInvalidCoinbase, payout)
 		}
-		bc.Balances[tx.To] += tx.Amount
-		fmt.Printf("[AddBlock:9] Added %f UNBT to %s, new balance: %f\n", tx.Amount, tx.To, bc.Balances[tx.To])
-		bc.Nonces[tx.From]++
-		fmt.Printf("[AddBlock:10] Incremented nonce for sender %s to %d\n", tx.From, bc.Nonces[tx.From])
-		bc.Miners[miner]++
+		total += payout.Amount
+	}
+	if math.Abs(total-value) > coinbaseTolerance {
+		return nil, fmt.Errorf("%w: pays %f UNBT, reward %f plus fees %f is %f", ErrInvalidCoinbase, total, blockReward, minerFees, value)
 	}
 
-	// Reward distribution
-	totalTx := len(transactions)
-	if totalTx > 0 {
-		type minerStat struct {
-			Miner   string
-			TxCount int
+	for _, payout := range payouts {
+		if _, ok := bc.Balances[payout.Address]; !ok {
+			bc.Balances[payout.Address] = 0
 		}
-		var miners []minerStat
-		for m, count := range bc.Miners {
-			miners = append(miners, minerStat{Miner: m, TxCount: count})
+		bc.Balances[payout.Address] += payout.Amount
+		bc.logs.chain.Debug("Reward paid", "address", payout.Address, "amount", payout.Amount, "balance", bc.Balances[payout.Address])
+	}
+	bc.Minted += blockReward
+	return payouts, nil
+}
+
+// removeFromPool drops the transactions of block, the processed ones the block
+// left out and any pooled transaction whose nonce is already used on chain. The
+// ones not included are recorded as dropped.
+func (bc *Blockchain) removeFromPool(block *Block, processed []transaction.Transaction) {
+	included := make(map[string]bool, len(block.Transactions))
+	for i := range block.Transactions {
+		included[block.Transactions[i].ID()] = true
+	}
+	excluded := make(map[string]bool, len(processed))
+	for i := range processed {
+		if id := processed[i].ID(); !included[id] {
+			excluded[id] = true
+		}
+	}
+	pool := bc.TransactionPool[:0]
+	for _, tx := range bc.TransactionPool {
+		id := tx.ID()
+		reason := ""
+		switch {
+		case included[id]:
+			delete(bc.poolIndex, id)
+			continue
+		case excluded[id]:
+			reason = fmt.Sprintf("left out of block %d", block.Index)
+		case tx.Nonce < bc.Nonces[tx.From]:
+			reason = "nonce used on chain"
+		default:
+			bc.poolIndex[id] = len(pool)
+			pool = append(pool, tx)
+			continue
 		}
-		sort.Slice(miners, func(i, j int) bool {
-			return miners[i].TxCount > miners[j].TxCount
-		})
+		delete(bc.poolIndex, id)
+		tx := tx
+		bc.recordDropped(tx, reason)
+		bc.events.publish(TxEvicted{ID: id, Tx: &tx, Reason: reason})
+	}
+	bc.TransactionPool = pool
+	bc.indexPoolAccounts()
+}
 
-		remainingReward := reward
-		if _, ok := bc.Balances[miners[0].Miner]; !ok {
-			bc.Balances[miners[0].Miner] = 0
+// applyTransaction charges fees and moves the amount, UNBT or tokens, or stakes or
+// unstakes it, returning the execution receipt. BasePower is regenerated up to the
+// block timestamp and covers the base fee when enough is left; other fees are paid in UNBT.
+// A transaction that cannot pay its fee is charged nothing; one that cannot pay its
+// amount still pays the fee. The second result is false when a failed transaction
+// must be left out of the block, in which case state is not touched.
+func (bc *Blockchain) applyTransaction(tx transaction.Transaction, block *Block) (Receipt, bool) {
+	payer := tx.Payer()
+	bc.updateBasePower(payer, block.Timestamp)
+	usedPower, totalCost := txCost(tx, bc.BasePower[payer])
+	receipt := Receipt{Status: ReceiptSuccess, BasePowerUsed: usedPower, FeePayer: tx.FeePayer}
+
+	// What the sender can spend once the fee is paid
+	spendable := bc.Balances[tx.From]
+	if payer == tx.From {
+		spendable -= totalCost
+	}
+	if balance := bc.Balances[payer]; balance < totalCost {
+		bc.logs.chain.Debug("Insufficient balance for fee", "payer", payer, "fee", totalCost)
+		receipt.Status = ReceiptFailed
+		receipt.Reason = fmt.Sprintf("insufficient balance for fee: need %f UNBT, have %f", totalCost, balance)
+		receipt.BasePowerUsed = 0
+		totalCost = 0
+	} else if tx.IsTokenTransfer {
+		if tokens := bc.TokenBalances[tx.TokenID][tx.From]; tokens < tx.Amount {
+			bc.logs.chain.Debug("Insufficient token balance", "from", tx.From, "token", tx.TokenID, "amount", tx.Amount)
+			receipt.Status = ReceiptFailed
+			receipt.Reason = fmt.Sprintf("insufficient token balance: need %f %s, have %f", tx.Amount, tx.TokenID, tokens)
 		}
-		bc.Balances[miners[0].Miner] += 5.0
-		remainingReward -= 5.0
-		fmt.Printf("[AddBlock:11] Top miner %s processed %d tx, awarded 5 UNBT, new balance: %f\n", miners[0].Miner, miners[0].TxCount, bc.Balances[miners[0].Miner])
-
-		if len(miners) > 1 {
-			remainingTx := totalTx - miners[0].TxCount
-			if remainingTx > 0 {
-				for i := 1; i < len(miners); i++ {
-					if _, ok := bc.Balances[miners[i].Miner]; !ok {
-						bc.Balances[miners[i].Miner] = 0
-					}
-					share := (float64(miners[i].TxCount) / float64(remainingTx)) * remainingReward
-					bc.Balances[miners[i].Miner] += share
-					fmt.Printf("[AddBlock:12] Miner %s processed %d tx, awarded %f UNBT, new balance: %f\n", miners[i].Miner, miners[i].TxCount, share, bc.Balances[miners[i].Miner])
-				}
-			}
+	} else if !spendsAmount(tx) {
+		var err error
+		if tx.Type == transaction.TxUnstake {
+			err = bc.checkUnstake(tx.From, tx.Amount, 0)
+		} else {
+			err = bc.checkDelegation(tx, block.Index, 0)
 		}
+		if err != nil {
+			bc.logs.chain.Debug("Transaction failed", "type", tx.Type, "from", tx.From, "reason", err)
+			receipt.Status = ReceiptFailed
+			receipt.Reason = err.Error()
+		}
+	} else if spendable < tx.Amount {
+		bc.logs.chain.Debug("Insufficient balance for amount", "from", tx.From, "amount", tx.Amount)
+		receipt.Status = ReceiptFailed
+		receipt.Reason = fmt.Sprintf("insufficient balance for amount: need %f UNBT, have %f after fee", tx.Amount, spendable)
+	}
+	if receipt.Status == ReceiptFailed && !bc.Params.IncludeFailedTxs {
+		return receipt, false
 	}
 
-	fmt.Println("[AddBlock:13] Appending block to chain...")
-	bc.Chain = append(bc.Chain, newBlock)
-	fmt.Printf("[AddBlock:14] Block added, chain length: %d\n", len(bc.Chain))
+	if receipt.BasePowerUsed > 0 {
+		bc.BasePower[payer] -= receipt.BasePowerUsed
+	}
+	if totalCost > 0 {
+		bc.Balances[payer] -= totalCost
+		receipt.FeeCharged = totalCost
+		bc.logs.chain.Debug("Fee charged", "payer", payer, "fee", totalCost)
+	}
+	if receipt.Status == ReceiptFailed {
+		return receipt, true
+	}
+
+	switch {
+	case tx.IsTokenTransfer:
+		bc.transferTokens(tx.TokenID, tx.From, tx.To, tx.Amount)
+		bc.logs.chain.Debug("Tokens moved", "token", tx.TokenID, "amount", tx.Amount, "from", tx.From, "to", tx.To)
+		return receipt, true
+	case tx.Type == transaction.TxStake:
+		bc.stake(tx.From, tx.Amount, block.Timestamp)
+		bc.logs.chain.Debug("Staked", "address", tx.From, "amount", tx.Amount, "stake", bc.Stakes[tx.From])
+		return receipt, true
+	case tx.Type == transaction.TxUnstake:
+		bc.unstake(tx.From, tx.Amount, block.Index, block.Timestamp)
+		bc.logs.chain.Debug("Unstaking", "address", tx.From, "amount", tx.Amount, "release_height", block.Index+bc.Params.UnbondingPeriod)
+		return receipt, true
+	case tx.Type == transaction.TxDelegate:
+		bc.delegate(tx.From, tx.To, int(tx.Amount), tx.ExpiryHeight, block.Timestamp)
+		bc.logs.chain.Debug("Delegated", "from", tx.From, "to", tx.To, "base_power", int(tx.Amount))
+		return receipt, true
+	case tx.Type == transaction.TxUndelegate:
+		bc.undelegate(tx.From, tx.To, block.Timestamp)
+		bc.logs.chain.Debug("Delegation revoked", "from", tx.From, "to", tx.To)
+		return receipt, true
+	}
+	bc.Balances[tx.From] -= tx.Amount
+	if _, ok := bc.Balances[tx.To]; !ok {
+		bc.Balances[tx.To] = 0
+	}
+	bc.Balances[tx.To] += tx.Amount
+	bc.logs.chain.Debug("UNBT moved", "amount", tx.Amount, "from", tx.From, "to", tx.To)
+	return receipt, true
 }
 
 // NewBlock creates a new block
 func NewBlock(transactions []transaction.Transaction, prevBlock *Block, miner string) *Block {
-	block := &Block{
+	block := createBlock(transactions, prevBlock, miner)
+	block.MineBlock()
+	return block
+}
+
+// createBlock creates a new block without mining it
+func createBlock(transactions []transaction.Transaction, prevBlock *Block, miner string) *Block {
+	return &Block{
 		Index:        prevBlock.Index + 1,
 		Timestamp:    time.Now().Unix(),
 		Transactions: transactions,
@@ -264,14 +680,19 @@ func NewBlock(transactions []transaction.Transaction, prevBlock *Block, miner st
 		Miner:        miner,
 		Nonce:        0,
 	}
-	block.MineBlock()
-	return block
+}
+
+// Height returns the index of the last block
+func (bc *Blockchain) Height() int {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return len(bc.Chain) - 1
 }
 
 // IsBlockchainValid checks the integrity of the blockchain
 func (bc *Blockchain) IsBlockchainValid() bool {
-	bc.mu.Lock()
-	defer bc.mu.Unlock()
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
 
 	for i := 1; i < len(bc.Chain); i++ {
 		currentBlock := bc.Chain[i]
@@ -279,7 +700,7 @@ func (bc *Blockchain) IsBlockchainValid() bool {
 		if currentBlock.PrevHash != prevBlock.Hash {
 			return false
 		}
-		if currentBlock.Hash != currentBlock.CalculateHash() {
+		if !currentBlock.HasValidProof() {
 			return false
 		}
 	}
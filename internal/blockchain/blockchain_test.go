@@ -1,7 +1,16 @@
 package blockchain
 
 import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strings"
 	"testing"
+	"unknownberrytrip/internal/logging"
 	"unknownberrytrip/internal/transaction"
 	"unknownberrytrip/internal/wallet"
 )
@@ -115,3 +124,963 @@ func TestAddValidSignedTransactionToPool(t *testing.T) {
 
 	t.Log("TestAddValidSignedTransactionToPool completed successfully")
 }
+
+func TestPoolRejectionErrors(t *testing.T) {
+	bc := NewBlockchain()
+	senderWallet := wallet.NewWallet()
+	bc.Balances[senderWallet.Address] = 10.0
+
+	forged := senderWallet.CreateTransaction("receiver", 1.0, 0)
+	forged.Amount = 2.0
+	negative := senderWallet.CreateTransaction("receiver", -5.0, 0)
+	gap := senderWallet.CreateTransaction("receiver", 1.0, 1)
+	tooMuch := senderWallet.CreateTransaction("receiver", 100.0, 0)
+	cases := []struct {
+		tx   *transaction.Transaction
+		want error
+		code string
+	}{
+		{forged, ErrInvalidSignature, "INVALID_SIGNATURE"},
+		{negative, ErrInvalidAmount, "INVALID_AMOUNT"},
+		{gap, ErrNonceGap, "NONCE_GAP"},
+		{tooMuch, ErrInsufficientBalance, "INSUFFICIENT_BALANCE"},
+	}
+	for _, c := range cases {
+		err := bc.AddTransactionToPool(*c.tx)
+		if !errors.Is(err, c.want) || ErrorCode(err) != c.code {
+			t.Errorf("Expected %s, got %v", c.code, err)
+		}
+	}
+	if details := ErrorDetails(bc.AddTransactionToPool(*tooMuch)); details["required"] != 100.0 {
+		t.Errorf("Expected the required amount in the details, got %v", details)
+	}
+
+	valid := senderWallet.CreateTransaction("receiver", 1.0, 0)
+	if err := bc.AddTransactionToPool(*valid); err != nil {
+		t.Fatalf("AddTransactionToPool failed: %v", err)
+	}
+	err := bc.AddTransactionToPool(*valid)
+	if !errors.Is(err, ErrNonceTooLow) || ErrorDetails(err)["expected"] != 1 {
+		t.Errorf("Expected NONCE_TOO_LOW with the expected nonce, got %v", err)
+	}
+}
+
+func TestAddBlockReceipts(t *testing.T) {
+	t.Log("Creating a new blockchain instance")
+	bc := NewBlockchain()
+
+	senderWallet := wallet.NewWallet()
+	receiverWallet := wallet.NewWallet()
+	bc.Balances[senderWallet.Address] = 30.0
+
+	t.Log("Creating a payable transaction followed by one exceeding the balance")
+	tx1 := senderWallet.CreateTransaction(receiverWallet.Address, 20.0, 0)
+	tx2 := senderWallet.CreateTransaction(receiverWallet.Address, 20.0, 1)
+	bc.AddBlock([]transaction.Transaction{*tx1, *tx2}, "miner")
+
+	block := bc.Chain[len(bc.Chain)-1]
+	if len(block.Transactions) != 2 || len(block.Receipts) != 2 {
+		t.Fatalf("Expected 2 transactions and 2 receipts, got %d and %d", len(block.Transactions), len(block.Receipts))
+	}
+
+	receipt, ok := bc.GetReceipt(tx2.ID())
+	if !ok {
+		t.Fatal("Expected receipt for failed transaction")
+	}
+	t.Logf("Failed receipt: %+v", receipt)
+	if receipt.Status != ReceiptFailed || receipt.Reason == "" {
+		t.Errorf("Expected failed receipt with reason, got %+v", receipt)
+	}
+	if receipt.BlockHeight != 1 || receipt.Index != 1 {
+		t.Errorf("Expected receipt at height 1 index 1, got %d/%d", receipt.BlockHeight, receipt.Index)
+	}
+	if bc.Nonces[senderWallet.Address] != 2 {
+		t.Errorf("Expected failed transaction to consume a nonce, got nonce %d", bc.Nonces[senderWallet.Address])
+	}
+	if bc.Balances[receiverWallet.Address] != 20.0 {
+		t.Errorf("Expected receiver balance 20.0, got %f", bc.Balances[receiverWallet.Address])
+	}
+}
+
+func TestAddBlockExcludesFailedTransactions(t *testing.T) {
+	params := DefaultChainParams()
+	params.IncludeFailedTxs = false
+	bc := NewBlockchainWithParams(params)
+
+	senderWallet := wallet.NewWallet()
+	bc.Balances[senderWallet.Address] = 5.0
+
+	tx := senderWallet.CreateTransaction("receiver", 20.0, 0)
+	tx.ExtraPower = 1
+	tx.Signature = senderWallet.SignTx(tx)
+	bc.AddBlock([]transaction.Transaction{*tx}, "miner")
+
+	block := bc.Chain[len(bc.Chain)-1]
+	if len(block.Transactions) != 0 {
+		t.Errorf("Expected failed transaction to be excluded, got %d transactions", len(block.Transactions))
+	}
+	if _, ok := bc.GetReceipt(tx.ID()); ok {
+		t.Error("Expected no receipt for excluded transaction")
+	}
+	if bc.Balances[senderWallet.Address] != 5.0 || bc.Nonces[senderWallet.Address] != 0 {
+		t.Errorf("Expected untouched sender state, got balance %f nonce %d", bc.Balances[senderWallet.Address], bc.Nonces[senderWallet.Address])
+	}
+}
+
+func TestGetTransactionConfirmations(t *testing.T) {
+	bc := NewBlockchain()
+	senderWallet := wallet.NewWallet()
+	bc.Balances[senderWallet.Address] = 10.0
+
+	tx := senderWallet.CreateTransaction("receiver", 1.0, 0)
+	bc.AddBlock([]transaction.Transaction{*tx}, "miner")
+
+	found, loc, confirmations, ok := bc.GetTransaction(tx.ID())
+	if !ok {
+		t.Fatal("Expected transaction to be indexed")
+	}
+	if found.ID() != tx.ID() || loc.BlockHeight != 1 || loc.Index != 0 || confirmations != 1 {
+		t.Errorf("Unexpected lookup result: %+v at %+v with %d confirmations", found, loc, confirmations)
+	}
+
+	bc.AddBlock(nil, "miner")
+	if _, _, confirmations, _ = bc.GetTransaction(tx.ID()); confirmations != 2 {
+		t.Errorf("Expected 2 confirmations after another block, got %d", confirmations)
+	}
+	if _, _, _, ok = bc.GetTransaction("unknown"); ok {
+		t.Error("Expected unknown transaction to be missing")
+	}
+}
+
+func TestPoolCommitmentsFollowBlocks(t *testing.T) {
+	bc := NewBlockchain()
+	senderWallet := wallet.NewWallet()
+	bc.Balances[senderWallet.Address] = 3.0
+
+	first := senderWallet.CreateTransaction("receiver", 1.5, 0)
+	second := senderWallet.CreateTransaction("receiver", 1.0, 1)
+	for _, tx := range []*transaction.Transaction{first, second} {
+		if err := bc.AddTransactionToPool(*tx); err != nil {
+			t.Fatalf("AddTransactionToPool failed: %v", err)
+		}
+	}
+	if err := bc.AddTransactionToPool(*senderWallet.CreateTransaction("receiver", 0.6, 2)); !errors.Is(err, ErrInsufficientBalance) {
+		t.Errorf("Expected the pooled amounts to be committed, got %v", err)
+	}
+
+	// The mined transaction leaves the pool commitments and the balance together
+	bc.AddBlock([]transaction.Transaction{*first}, "miner")
+	if err := bc.AddTransactionToPool(*senderWallet.CreateTransaction("receiver", 0.6, 2)); !errors.Is(err, ErrInsufficientBalance) {
+		t.Errorf("Expected only the pooled amount to stay committed, got %v", err)
+	}
+	third := senderWallet.CreateTransaction("receiver", 0.5, 2)
+	if err := bc.AddTransactionToPool(*third); err != nil {
+		t.Fatalf("AddTransactionToPool failed: %v", err)
+	}
+	for i, tx := range []*transaction.Transaction{second, third} {
+		if status, _ := bc.TransactionStatus(tx.ID()); status.Status != TxPending || status.PoolPosition != i+1 || status.Transaction.ID() != tx.ID() {
+			t.Errorf("Expected transaction %d pending at position %d, got %+v", i, i+1, status)
+		}
+	}
+}
+
+func TestTransactionStatus(t *testing.T) {
+	params := DefaultChainParams()
+	params.MaxBlockTxs = 1
+	bc := NewBlockchainWithParams(params)
+	senderWallet := wallet.NewWallet()
+	bc.Balances[senderWallet.Address] = 10.0
+
+	first := senderWallet.CreateTransaction("receiver", 1.0, 0)
+	second := senderWallet.CreateTransaction("receiver", 1.0, 1)
+	for _, tx := range []*transaction.Transaction{first, second} {
+		if err := bc.AddTransactionToPool(*tx); err != nil {
+			t.Fatalf("AddTransactionToPool failed: %v", err)
+		}
+	}
+	if status, _ := bc.TransactionStatus(first.ID()); status.Status != TxPending || status.PoolPosition != 1 {
+		t.Errorf("Expected the first transaction pending at the front, got %+v", status)
+	}
+	if status, _ := bc.TransactionStatus(second.ID()); status.Status != TxQueued || status.PoolPosition != 2 {
+		t.Errorf("Expected the second transaction queued behind a full block, got %+v", status)
+	}
+
+	bc.AddBlock(bc.PendingTransactions(), "miner")
+	status, _ := bc.TransactionStatus(first.ID())
+	if status.Status != TxIncluded || status.BlockHeight != 1 || status.BlockHash != bc.Chain[1].Hash || status.Confirmations != 1 || status.Receipt == nil {
+		t.Errorf("Expected the first transaction included in block 1, got %+v", status)
+	}
+	if status, _ := bc.TransactionStatus(second.ID()); status.Status != TxPending || status.PoolPosition != 1 || status.Transaction.ID() != second.ID() {
+		t.Errorf("Expected the second transaction to move to the front, got %+v", status)
+	}
+
+	// A conflicting transaction takes nonce 1 on chain and fails to pay its amount
+	conflicting := senderWallet.CreateTransaction("receiver", 100.0, 1)
+	bc.AddBlock([]transaction.Transaction{*conflicting}, "miner")
+	if status, _ := bc.TransactionStatus(conflicting.ID()); status.Status != TxFailed || status.Receipt.Status != ReceiptFailed {
+		t.Errorf("Expected the conflicting transaction to fail, got %+v", status)
+	}
+	if status, _ := bc.TransactionStatus(second.ID()); status.Status != TxDropped || status.Reason != "nonce used on chain" || status.DroppedHeight != 2 {
+		t.Errorf("Expected the second transaction dropped, got %+v", status)
+	}
+	if _, ok := bc.TransactionStatus("unknown"); ok {
+		t.Error("Expected an unknown transaction to be missing")
+	}
+}
+
+func TestSimulateTransactionDoesNotLogExecution(t *testing.T) {
+	bc := NewBlockchain()
+	var out bytes.Buffer
+	bc.SetLogger(logging.New(&out, logging.Options{Level: logging.LevelDebug}))
+	stakerWallet := wallet.NewWallet()
+	bc.Balances[stakerWallet.Address] = 10.0
+
+	// Saving logs outside the chain lock while simulations run
+	path := filepath.Join(t.TempDir(), "state.json")
+	saved := make(chan error)
+	go func() {
+		for i := 0; i < 20; i++ {
+			if err := bc.SaveToFile(path); err != nil {
+				saved <- err
+				return
+			}
+		}
+		saved <- nil
+	}()
+	for i := 0; i < 20; i++ {
+		if sim := bc.SimulateTransaction(*stakerWallet.CreateStakeTransaction(5.0, 0), true); !sim.Accepted {
+			t.Fatalf("Expected the stake to be accepted, got %v", sim.Err)
+		}
+	}
+	if err := <-saved; err != nil {
+		t.Fatalf("SaveToFile failed: %v", err)
+	}
+	if strings.Contains(out.String(), "Staked") || bc.Stakes[stakerWallet.Address] != 0 {
+		t.Errorf("Expected the simulated stake neither logged nor applied, got stake %f and %q", bc.Stakes[stakerWallet.Address], out.String())
+	}
+	out.Reset()
+	bc.AddBlock([]transaction.Transaction{*stakerWallet.CreateStakeTransaction(5.0, 0)}, "miner")
+	if !strings.Contains(out.String(), "Staked") {
+		t.Errorf("Expected real blocks to still log execution, got %q", out.String())
+	}
+}
+
+func TestSimulateTransaction(t *testing.T) {
+	bc := NewBlockchain()
+	senderWallet := wallet.NewWallet()
+	bc.Balances[senderWallet.Address] = 10.0
+	pooled := senderWallet.CreateTransaction("receiver", 1.0, 0)
+	if err := bc.AddTransactionToPool(*pooled); err != nil {
+		t.Fatalf("AddTransactionToPool failed: %v", err)
+	}
+
+	tx := senderWallet.CreateTransaction("receiver", 2.0, 1)
+	tx.ExtraPower = 5
+	tx.Signature = senderWallet.SignTx(tx)
+	sim := bc.SimulateTransaction(*tx, true)
+	if !sim.Accepted || sim.Err != nil || sim.Receipt == nil || sim.Receipt.Status != ReceiptSuccess {
+		t.Fatalf("Expected the transaction to be accepted and succeed, got %+v", sim)
+	}
+	if sim.Fee.BasePowerUsed != 1 || sim.Fee.BaseFee != 0 || math.Abs(sim.Fee.ExtraPowerCost-0.005) > 1e-9 || sim.Fee.TotalCost != sim.Fee.ExtraPowerCost {
+		t.Errorf("Expected BasePower to cover the base fee and UNBT the ExtraPower, got %+v", sim.Fee)
+	}
+	// ExtraPower puts it ahead of the pooled transfer, which then runs in the same block
+	want := map[string][2]float64{senderWallet.Address: {10.0, 10.0 - 2.0 - 1.0 - sim.Fee.TotalCost}, "receiver": {0, 3.0}}
+	for _, change := range sim.Balances {
+		if w := want[change.Address]; change.Before != w[0] || math.Abs(change.After-w[1]) > 1e-9 {
+			t.Errorf("Unexpected balance change %+v, want %v", change, w)
+		}
+	}
+	if bc.Balances[senderWallet.Address] != 10.0 || bc.Nonces[senderWallet.Address] != 0 || len(bc.TransactionPool) != 1 {
+		t.Error("Expected the simulation to leave state and pool untouched")
+	}
+
+	unsigned := *tx
+	unsigned.Signature = ""
+	if sim := bc.SimulateTransaction(unsigned, false); !sim.Accepted {
+		t.Errorf("Expected an unsigned transaction to be priced, got %v", sim.Err)
+	}
+	if sim := bc.SimulateTransaction(unsigned, true); !errors.Is(sim.Err, ErrInvalidSignature) {
+		t.Errorf("Expected the signature to be checked, got %v", sim.Err)
+	}
+	tooMuch := senderWallet.CreateTransaction("receiver", 100.0, 1)
+	sim = bc.SimulateTransaction(*tooMuch, true)
+	if sim.Accepted || !errors.Is(sim.Err, ErrInsufficientBalance) || sim.Receipt != nil || sim.Fee.BasePowerRequired != 1 {
+		t.Errorf("Expected a priced rejection for insufficient balance, got %+v", sim)
+	}
+}
+
+func TestAddressHistory(t *testing.T) {
+	bc := NewBlockchain()
+	senderWallet := wallet.NewWallet()
+	bc.Balances[senderWallet.Address] = 100.0
+
+	t.Log("Adding three blocks with one transfer each")
+	for nonce := 0; nonce < 3; nonce++ {
+		tx := senderWallet.CreateTransaction("receiver", 1.0, nonce)
+		bc.AddBlock([]transaction.Transaction{*tx}, senderWallet.Address)
+	}
+
+	page := bc.GetAddressHistory(senderWallet.Address, HistoryQuery{})
+	t.Logf("Sender history: %+v", page.Entries)
+	if len(page.Entries) != 6 {
+		t.Fatalf("Expected 3 transfers and 3 rewards, got %d entries", len(page.Entries))
+	}
+	if page.Entries[0].BlockHeight != 3 {
+		t.Errorf("Expected newest entry first, got height %d", page.Entries[0].BlockHeight)
+	}
+
+	outgoing := bc.GetAddressHistory(senderWallet.Address, HistoryQuery{Direction: DirectionOut, Limit: 2})
+	if len(outgoing.Entries) != 2 || outgoing.NextHeight != 1 {
+		t.Fatalf("Expected 2 outgoing entries and next height 1, got %d and %d", len(outgoing.Entries), outgoing.NextHeight)
+	}
+	rest := bc.GetAddressHistory(senderWallet.Address, HistoryQuery{Direction: DirectionOut, ToHeight: outgoing.NextHeight, Limit: 2})
+	if len(rest.Entries) != 1 || rest.NextHeight != -1 {
+		t.Errorf("Expected last outgoing entry and no next page, got %d and %d", len(rest.Entries), rest.NextHeight)
+	}
+
+	t.Log("Rebuilding the index from blocks on load")
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := bc.SaveToFile(path); err != nil {
+		t.Fatalf("SaveToFile failed: %v", err)
+	}
+	loaded, err := LoadBlockchain(path)
+	if err != nil {
+		t.Fatalf("LoadBlockchain failed: %v", err)
+	}
+	incoming := loaded.GetAddressHistory("receiver", HistoryQuery{Direction: DirectionIn})
+	if len(incoming.Entries) != 3 || incoming.Entries[0].Counterparty != senderWallet.Address {
+		t.Errorf("Expected 3 rebuilt incoming entries, got %+v", incoming.Entries)
+	}
+}
+
+func TestAddBlockContextCancelledRollsBack(t *testing.T) {
+	bc := NewBlockchain()
+	senderWallet := wallet.NewWallet()
+	bc.Balances[senderWallet.Address] = 10.0
+
+	tx := senderWallet.CreateTransaction("receiver", 1.0, 0)
+	if err := bc.AddTransactionToPool(*tx); err != nil {
+		t.Fatalf("AddTransactionToPool failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := bc.AddBlockContext(ctx, []transaction.Transaction{*tx}, "miner"); err == nil {
+		t.Fatal("Expected cancelled mining to fail")
+	}
+	if len(bc.Chain) != 1 || bc.Balances[senderWallet.Address] != 10.0 || bc.Nonces[senderWallet.Address] != 0 {
+		t.Errorf("Expected state rolled back, got %d blocks, balance %f, nonce %d", len(bc.Chain), bc.Balances[senderWallet.Address], bc.Nonces[senderWallet.Address])
+	}
+	if len(bc.TransactionPool) != 1 {
+		t.Errorf("Expected transaction to stay pooled, pool size %d", len(bc.TransactionPool))
+	}
+}
+
+func TestMinerFindsValidProof(t *testing.T) {
+	bc := NewBlockchain()
+	block := createBlock(nil, bc.Chain[0], "miner")
+
+	miner := NewMiner(4)
+	if err := miner.Mine(context.Background(), block); err != nil {
+		t.Fatalf("Mine failed: %v", err)
+	}
+	t.Logf("Mined nonce %d with hash %s at %.0f H/s", block.Nonce, block.Hash, miner.Hashrate())
+	if !block.HasValidProof() {
+		t.Error("Expected mined block to have a valid proof")
+	}
+	if miner.TotalHashes() == 0 || miner.Hashrate() <= 0 {
+		t.Errorf("Expected hashes to be counted, got %d at %f H/s", miner.TotalHashes(), miner.Hashrate())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	unmined := createBlock(nil, bc.Chain[0], "miner")
+	if err := miner.Mine(ctx, unmined); err == nil || unmined.Hash != "" {
+		t.Errorf("Expected cancelled mining to leave the block unmined, got err %v hash %q", err, unmined.Hash)
+	}
+}
+
+func TestImportBlockRejectsStaleTip(t *testing.T) {
+	bc := NewBlockchain()
+	stale, _, _, _ := bc.buildBlock(nil, "miner")
+	stale.MineBlock()
+
+	bc.AddBlock(nil, "miner")
+	if err := bc.importBlock(stale, nil); err != ErrStaleBlock {
+		t.Errorf("Expected ErrStaleBlock, got %v", err)
+	}
+}
+
+func TestBlockTemplateSubmit(t *testing.T) {
+	bc := NewBlockchain()
+	senderWallet := wallet.NewWallet()
+	bc.Balances[senderWallet.Address] = 10.0
+	tx := senderWallet.CreateTransaction("receiver", 1.0, 0)
+	if err := bc.AddTransactionToPool(*tx); err != nil {
+		t.Fatalf("AddTransactionToPool failed: %v", err)
+	}
+
+	tmpl := bc.GetBlockTemplate("external_miner", nil)
+	t.Logf("Template %s for block #%d, difficulty %d", tmpl.ID, tmpl.Index, tmpl.Difficulty)
+	if tmpl.Index != 1 || len(tmpl.Transactions) != 1 {
+		t.Fatalf("Expected template for block #1 with 1 transaction, got #%d with %d", tmpl.Index, len(tmpl.Transactions))
+	}
+
+	// The template is built once per tip: later pool transactions wait for the next one
+	later := senderWallet.CreateTransaction("receiver", 1.0, 1)
+	if err := bc.AddTransactionToPool(*later); err != nil {
+		t.Fatalf("AddTransactionToPool failed: %v", err)
+	}
+	if again := bc.GetBlockTemplate("external_miner", nil); again.ID != tmpl.ID || again == tmpl {
+		t.Errorf("Expected a copy of the cached template, got %s", again.ID)
+	}
+	if other := bc.GetBlockTemplate("other_miner", nil); other.ID == tmpl.ID || len(other.Transactions) != 2 {
+		t.Errorf("Expected another miner to get its own template with both transactions, got %d", len(other.Transactions))
+	}
+
+	prefix, _ := hex.DecodeString(tmpl.HeaderPrefix)
+	badNonce := 0
+	for sum := hashHeader(prefix, 0); meetsTarget(sum[:], tmpl.Difficulty); sum = hashHeader(prefix, uint64(badNonce)) {
+		badNonce++
+	}
+	if _, err := bc.SubmitBlock(tmpl.ID, badNonce); err != ErrInvalidProof {
+		t.Errorf("Expected ErrInvalidProof for a wrong nonce, got %v", err)
+	}
+
+	nonce, _, err := NewMiner(2).MineHeader(context.Background(), prefix, tmpl.Difficulty)
+	if err != nil {
+		t.Fatalf("MineHeader failed: %v", err)
+	}
+	block, err := bc.SubmitBlock(tmpl.ID, int(nonce))
+	if err != nil {
+		t.Fatalf("SubmitBlock failed: %v", err)
+	}
+	if bc.Height() != 1 || block.Miner != "external_miner" || bc.Balances["receiver"] != 1.0 {
+		t.Errorf("Expected imported block paying the receiver, got height %d miner %s balance %f", bc.Height(), block.Miner, bc.Balances["receiver"])
+	}
+	if len(bc.TransactionPool) != 1 {
+		t.Errorf("Expected the later transaction to stay pooled, got %d", len(bc.TransactionPool))
+	}
+	if _, err := bc.SubmitBlock(tmpl.ID, int(nonce)); err != ErrUnknownTemplate {
+		t.Errorf("Expected ErrUnknownTemplate after the tip moved, got %v", err)
+	}
+	if next := bc.GetBlockTemplate("external_miner", nil); next.Index != 2 || len(next.Transactions) != 1 {
+		t.Errorf("Expected a new template on the new tip with the later transaction, got #%d with %d", next.Index, len(next.Transactions))
+	}
+}
+
+func TestEmissionSchedule(t *testing.T) {
+	params := DefaultChainParams()
+	params.InitialReward = 8
+	params.HalvingInterval = 2
+	params.TailEmission = 1.5
+	params.MaxSupply = 0
+	bc := NewBlockchainWithParams(params)
+
+	expected := map[int]float64{1: 8, 2: 8, 3: 4, 4: 4, 5: 2, 7: 1.5, 100: 1.5}
+	for height, want := range expected {
+		if got := bc.BlockReward(height); got != want {
+			t.Errorf("Expected reward %f at height %d, got %f", want, height, got)
+		}
+	}
+
+	t.Log("Capping the supply just above the genesis allocation")
+	params.MaxSupply = params.GenesisAlloc["genesis_miner"] + 12
+	bc = NewBlockchainWithParams(params)
+	senderWallet := wallet.NewWallet()
+	bc.Balances[senderWallet.Address] = 10.0
+	for nonce := 0; nonce < 3; nonce++ {
+		tx := senderWallet.CreateTransaction("receiver", 1.0, nonce)
+		bc.AddBlock([]transaction.Transaction{*tx}, "miner")
+	}
+	if bc.Balances["miner"] != 12 {
+		t.Errorf("Expected miner to be paid 8 + 4 + 0 under the cap, got %f", bc.Balances["miner"])
+	}
+
+	supply := bc.Supply()
+	t.Logf("Supply: %+v", supply)
+	if supply.TotalMinted != params.MaxSupply || supply.Remaining != 0 || supply.NextReward != 0 {
+		t.Errorf("Expected exhausted supply, got %+v", supply)
+	}
+	if supply.Circulating != supply.TotalMinted+10.0 {
+		t.Errorf("Expected circulating to include the test balance, got %f", supply.Circulating)
+	}
+}
+
+func TestImportBlockRejectsInflatedCoinbase(t *testing.T) {
+	bc := NewBlockchain()
+	senderWallet := wallet.NewWallet()
+	bc.Balances[senderWallet.Address] = 10.0
+	tx := senderWallet.CreateTransaction("receiver", 1.0, 0)
+	if err := bc.AddTransactionToPool(*tx); err != nil {
+		t.Fatalf("AddTransactionToPool failed: %v", err)
+	}
+
+	tmpl := bc.GetBlockTemplate("miner", func(total float64) []Payout {
+		return []Payout{{Address: "miner", Amount: 2 * total}}
+	})
+	prefix, _ := hex.DecodeString(tmpl.HeaderPrefix)
+	nonce, _, _ := NewMiner(1).MineHeader(context.Background(), prefix, tmpl.Difficulty)
+	if _, err := bc.SubmitBlock(tmpl.ID, int(nonce)); !errors.Is(err, ErrInvalidCoinbase) {
+		t.Errorf("Expected ErrInvalidCoinbase, got %v", err)
+	}
+	if bc.Height() != 0 || bc.Balances[senderWallet.Address] != 10.0 {
+		t.Error("Expected rejected block to leave state untouched")
+	}
+}
+
+func TestFeesSplitBetweenMinerTreasuryAndBurn(t *testing.T) {
+	params := DefaultChainParams()
+	params.FeeMinerShare = 0.5
+	params.FeeTreasuryShare = 0.3
+	params.TreasuryAddress = "treasury"
+	bc := NewBlockchainWithParams(params)
+
+	senderWallet := wallet.NewWallet()
+	bc.Balances[senderWallet.Address] = 10.0
+	tx := senderWallet.CreateTransaction("receiver", 1.0, 0)
+	tx.ExtraPower = 100 // 0.1 UNBT
+	tx.Signature = senderWallet.SignTx(tx)
+	bc.AddBlock([]transaction.Transaction{*tx}, "miner")
+
+	fees := bc.Chain[1].Fees
+	t.Logf("Block fees: %+v", fees)
+	if math.Abs(fees.Total-0.1) > 1e-12 || math.Abs(fees.Miner-0.05) > 1e-12 || math.Abs(fees.Treasury-0.03) > 1e-12 || math.Abs(fees.Burned-0.02) > 1e-12 {
+		t.Errorf("Unexpected fee split: %+v", fees)
+	}
+	if math.Abs(bc.Balances["miner"]-(reward+0.05)) > 1e-12 {
+		t.Errorf("Expected miner paid reward plus fee share, got %f", bc.Balances["miner"])
+	}
+	if bc.Balances["treasury"] != fees.Treasury || bc.Burned != fees.Burned {
+		t.Errorf("Expected treasury %f and burned %f, got %f and %f", fees.Treasury, fees.Burned, bc.Balances["treasury"], bc.Burned)
+	}
+	page := bc.GetAddressHistory("treasury", HistoryQuery{})
+	if len(page.Entries) != 1 || page.Entries[0].Kind != KindFee {
+		t.Errorf("Expected a fee entry in treasury history, got %+v", page.Entries)
+	}
+}
+
+func TestTokenTransfersUseTokenLedger(t *testing.T) {
+	senderWallet := wallet.NewWallet()
+	params := DefaultChainParams()
+	params.GenesisAlloc[senderWallet.Address] = 1.0
+	params.GenesisTokens = map[string]map[string]float64{"BERRY_TOKEN": {senderWallet.Address: 100.0}}
+	bc := NewBlockchainWithParams(params)
+
+	tokenTx := senderWallet.CreateTransaction("receiver", 40.0, 0)
+	tokenTx.IsTokenTransfer = true
+	tokenTx.TokenID = "BERRY_TOKEN"
+	tokenTx.Signature = senderWallet.SignTx(tokenTx)
+	if err := bc.AddTransactionToPool(*tokenTx); err != nil {
+		t.Fatalf("Expected a token transfer larger than the UNBT balance to be accepted, got %v", err)
+	}
+	overdraft := senderWallet.CreateTransaction("receiver", 70.0, 1)
+	overdraft.IsTokenTransfer = true
+	overdraft.TokenID = "BERRY_TOKEN"
+	overdraft.Signature = senderWallet.SignTx(overdraft)
+	if err := bc.AddTransactionToPool(*overdraft); err == nil {
+		t.Error("Expected a transfer beyond the pending token balance to be rejected")
+	}
+
+	bc.AddBlock([]transaction.Transaction{*tokenTx}, "miner")
+	if got := bc.GetTokenBalance("BERRY_TOKEN", "receiver"); got != 40.0 {
+		t.Errorf("Expected receiver to hold 40 BERRY_TOKEN, got %f", got)
+	}
+	if bc.GetTokenBalance("BERRY_TOKEN", senderWallet.Address) != 60.0 || bc.Balances["receiver"] != 0 {
+		t.Errorf("Expected tokens to move without touching UNBT balances")
+	}
+}
+
+func TestAuditChainConservesSupply(t *testing.T) {
+	senderWallet := wallet.NewWallet()
+	params := DefaultChainParams()
+	params.FeeMinerShare = 0.5
+	params.GenesisAlloc[senderWallet.Address] = 10.0
+	params.GenesisTokens = map[string]map[string]float64{"BERRY_TOKEN": {senderWallet.Address: 100.0}}
+	bc := NewBlockchainWithParams(params)
+	bc.AssertSupply = true
+
+	tx := senderWallet.CreateTransaction("receiver", 1.0, 0)
+	tx.ExtraPower = 100
+	tx.Signature = senderWallet.SignTx(tx)
+	tokenTx := senderWallet.CreateTransaction("receiver", 40.0, 1)
+	tokenTx.IsTokenTransfer = true
+	tokenTx.TokenID = "BERRY_TOKEN"
+	tokenTx.Signature = senderWallet.SignTx(tokenTx)
+	if err := bc.AddBlockContext(context.Background(), []transaction.Transaction{*tx, *tokenTx}, "miner"); err != nil {
+		t.Fatalf("AddBlock failed: %v", err)
+	}
+	if got := bc.GetTokenBalance("BERRY_TOKEN", "receiver"); got != 40.0 {
+		t.Errorf("Expected receiver to hold 40 BERRY_TOKEN, got %f", got)
+	}
+
+	report := bc.AuditChain()
+	if !report.OK() {
+		t.Fatalf("Expected audit to pass, got violations: %v", report.Violations)
+	}
+	if len(report.Checks) != 2 {
+		t.Errorf("Expected UNBT and token checks, got %+v", report.Checks)
+	}
+
+	bc.Balances["receiver"] += 5
+	bc.TokenBalances["BERRY_TOKEN"]["receiver"] -= 1
+	report = bc.AuditChain()
+	if len(report.Violations) != 2 {
+		t.Errorf("Expected UNBT and token violations, got %v", report.Violations)
+	}
+}
+
+func TestSupplyViolationHaltsChain(t *testing.T) {
+	bc := NewBlockchain()
+	before := bc.supplyTotals()
+	bc.Balances["thief"] = 1.0
+	err := bc.checkBlockSupply(&Block{Index: 1}, before, 0)
+	if !errors.Is(err, ErrSupplyViolation) {
+		t.Fatalf("Expected ErrSupplyViolation, got %v", err)
+	}
+	bc.halt(err)
+
+	select {
+	case <-bc.Halted():
+	default:
+		t.Fatal("Expected Halted channel to be closed")
+	}
+	if err := bc.AddBlockContext(context.Background(), nil, "miner"); !errors.Is(err, ErrHalted) {
+		t.Errorf("Expected ErrHalted from AddBlockContext, got %v", err)
+	}
+}
+
+func TestRegenerateBasePower(t *testing.T) {
+	const day = 24 * 3600
+	tests := []struct {
+		name       string
+		bp         int
+		lastUpdate int64
+		at         int64
+		wantBP     int
+		wantUpdate int64
+	}{
+		{"no time passed", 40, 1000, 1000, 40, 1000},
+		{"clock went back", 40, 1000, 500, 40, 1000},
+		{"partial day", 0, 0, day / 4, 25, day / 4},
+		{"remainder carried", 0, 0, 1000, 1, 864},
+		{"capped", 90, 0, day / 2, dailyBP, day / 2},
+		{"several days", 0, 0, 3 * day, dailyBP, 3 * day},
+	}
+	for _, tt := range tests {
+		bp, lastUpdate := regenerateBasePower(tt.bp, tt.lastUpdate, tt.at, dailyBP)
+		if bp != tt.wantBP || lastUpdate != tt.wantUpdate {
+			t.Errorf("%s: got (%d, %d), want (%d, %d)", tt.name, bp, lastUpdate, tt.wantBP, tt.wantUpdate)
+		}
+	}
+}
+
+func TestBasePowerChargedOnceByBlock(t *testing.T) {
+	senderWallet := wallet.NewWallet()
+	params := DefaultChainParams()
+	params.GenesisAlloc[senderWallet.Address] = 10.0
+	params.GenesisTokens = map[string]map[string]float64{"BERRY_TOKEN": {senderWallet.Address: 5.0}}
+	bc := NewBlockchainWithParams(params)
+	bc.BasePower[senderWallet.Address] = baseTokenPower
+
+	tokenTx := senderWallet.CreateTransaction("receiver", 5.0, 0)
+	tokenTx.IsTokenTransfer = true
+	tokenTx.TokenID = "BERRY_TOKEN"
+	tokenTx.Signature = senderWallet.SignTx(tokenTx)
+	if err := bc.AddTransactionToPool(*tokenTx); err != nil {
+		t.Fatalf("Failed to pool token tx: %v", err)
+	}
+	tx := senderWallet.CreateTransaction("receiver", 1.0, 1)
+	tx.Signature = senderWallet.SignTx(tx)
+	if err := bc.AddTransactionToPool(*tx); err != nil {
+		t.Fatalf("Failed to pool tx: %v", err)
+	}
+	if bc.BasePower[senderWallet.Address] != baseTokenPower {
+		t.Errorf("Expected pool to leave BasePower untouched, got %d", bc.BasePower[senderWallet.Address])
+	}
+
+	bc.AddBlock(bc.PendingTransactions(), "miner")
+	receipts := bc.Chain[1].Receipts
+	if len(receipts) != 2 {
+		t.Fatalf("Expected 2 receipts, got %d", len(receipts))
+	}
+	// The token transfer spends the BasePower, so the UNBT transfer pays the base fee
+	if receipts[0].BasePowerUsed != baseTokenPower || receipts[0].FeeCharged != 0 {
+		t.Errorf("Expected token tx paid with BasePower, got %+v", receipts[0])
+	}
+	if receipts[1].BasePowerUsed != 0 || receipts[1].FeeCharged != baseFee {
+		t.Errorf("Expected UNBT tx to pay the base fee, got %+v", receipts[1])
+	}
+	if bc.LastBPUpdate[senderWallet.Address] < bc.Chain[0].Timestamp || bc.LastBPUpdate[senderWallet.Address] > bc.Chain[1].Timestamp {
+		t.Errorf("Expected BasePower update time within block timestamps, got %d", bc.LastBPUpdate[senderWallet.Address])
+	}
+}
+
+func TestStakeRaisesBasePowerAndUnbonds(t *testing.T) {
+	stakerWallet := wallet.NewWallet()
+	params := DefaultChainParams()
+	params.GenesisAlloc[stakerWallet.Address] = 20.0
+	params.UnbondingPeriod = 2
+	bc := NewBlockchainWithParams(params)
+	bc.AssertSupply = true
+
+	if err := bc.AddTransactionToPool(*stakerWallet.CreateStakeTransaction(5.0, 0)); err != nil {
+		t.Fatalf("Failed to pool stake tx: %v", err)
+	}
+	bc.AddBlock(bc.PendingTransactions(), "miner")
+	info := bc.GetStake(stakerWallet.Address)
+	if info.Staked != 5.0 || info.Capacity != dailyBP+50 {
+		t.Fatalf("Expected 5 UNBT staked for %d BP capacity, got %+v", dailyBP+50, info)
+	}
+	if err := bc.AddTransactionToPool(*stakerWallet.CreateUnstakeTransaction(6.0, 1)); err == nil {
+		t.Error("Expected unstaking more than the stake to be rejected")
+	}
+
+	if err := bc.AddTransactionToPool(*stakerWallet.CreateUnstakeTransaction(5.0, 1)); err != nil {
+		t.Fatalf("Failed to pool unstake tx: %v", err)
+	}
+	bc.AddBlock(bc.PendingTransactions(), "miner")
+	info = bc.GetStake(stakerWallet.Address)
+	if info.Staked != 0 || info.Capacity != dailyBP || len(info.Unbonding) != 1 || info.Unbonding[0].ReleaseHeight != 4 {
+		t.Fatalf("Expected stake unbonding until block 4 at base capacity, got %+v", info)
+	}
+	if info.BasePower > dailyBP {
+		t.Errorf("Expected BasePower capped to capacity after unstaking, got %d", info.BasePower)
+	}
+	balance := bc.Balances[stakerWallet.Address]
+
+	bc.AddBlock(nil, "miner")
+	if bc.Balances[stakerWallet.Address] != balance {
+		t.Errorf("Expected unbonding UNBT locked until block 4")
+	}
+	bc.AddBlock(nil, "miner")
+	if bc.Balances[stakerWallet.Address] != balance+5.0 || len(bc.Chain[4].Unbonded) != 1 {
+		t.Errorf("Expected 5 UNBT released at block 4, balance %f -> %f", balance, bc.Balances[stakerWallet.Address])
+	}
+	if report := bc.AuditChain(); !report.OK() {
+		t.Errorf("Expected audit to pass, got %v", report.Violations)
+	}
+}
+
+func TestStakeChangeSettlesBasePowerFirst(t *testing.T) {
+	bc := NewBlockchain()
+	bc.Balances["staker"] = 20.0
+	start := bc.Chain[0].Timestamp
+	bc.BasePower["staker"], bc.LastBPUpdate["staker"] = 0, start
+
+	// Half a day at 100 BP per day, then half a day at 200 once 10 UNBT are staked
+	bc.stake("staker", 10.0, start+bpPeriod/2)
+	if bp, _ := bc.basePowerAt("staker", start+bpPeriod); bp != dailyBP/2+dailyBP {
+		t.Errorf("Expected %d BP regenerated across the stake, got %d", dailyBP/2+dailyBP, bp)
+	}
+
+	// A quarter day at 200 BP per day, then a quarter day at 100 after unstaking
+	bc.BasePower["staker"], bc.LastBPUpdate["staker"] = 0, start
+	bc.unstake("staker", 10.0, 1, start+bpPeriod/4)
+	if bp, _ := bc.basePowerAt("staker", start+bpPeriod/2); bp != dailyBP/2+dailyBP/4 {
+		t.Errorf("Expected %d BP regenerated across the unstake, got %d", dailyBP/2+dailyBP/4, bp)
+	}
+}
+
+func TestDelegatedBasePowerPaysFees(t *testing.T) {
+	backendWallet := wallet.NewWallet()
+	userWallet := wallet.NewWallet()
+	params := DefaultChainParams()
+	params.GenesisAlloc[backendWallet.Address] = 10.0
+	params.GenesisAlloc[userWallet.Address] = 10.0
+	bc := NewBlockchainWithParams(params)
+
+	if err := bc.AddTransactionToPool(*backendWallet.CreateDelegateTransaction(userWallet.Address, dailyBP+1, 0, 0)); err == nil {
+		t.Error("Expected delegating more than the capacity to be rejected")
+	}
+	if err := bc.AddTransactionToPool(*backendWallet.CreateDelegateTransaction(userWallet.Address, 60, 3, 0)); err != nil {
+		t.Fatalf("Failed to pool delegation: %v", err)
+	}
+	bc.AddBlock(bc.PendingTransactions(), "miner")
+	if got := bc.GetStake(userWallet.Address).Capacity; got != dailyBP+60 {
+		t.Errorf("Expected delegatee capacity %d, got %d", dailyBP+60, got)
+	}
+	if got := bc.GetStake(backendWallet.Address).Capacity; got != dailyBP-60 {
+		t.Errorf("Expected delegator capacity %d, got %d", dailyBP-60, got)
+	}
+
+	// The user spends its own BasePower, then draws on the delegated capacity
+	bc.BasePower[userWallet.Address] = 0
+	bc.BasePower[backendWallet.Address] = 0
+	bc.LastBPUpdate[userWallet.Address] -= 24 * 3600
+	bc.LastBPUpdate[backendWallet.Address] -= 24 * 3600
+	if got := bc.GetStake(userWallet.Address).BasePower; got != dailyBP+60 {
+		t.Errorf("Expected a day to regenerate %d BP for the delegatee, got %d", dailyBP+60, got)
+	}
+	if got := bc.GetStake(backendWallet.Address).BasePower; got != dailyBP-60 {
+		t.Errorf("Expected a day to regenerate %d BP for the delegator, got %d", dailyBP-60, got)
+	}
+
+	if len(bc.GetDelegations(userWallet.Address)) != 1 {
+		t.Fatalf("Expected one delegation to the user")
+	}
+	bc.AddBlock(nil, "miner")
+	bc.AddBlock(nil, "miner")
+	if len(bc.GetDelegations(userWallet.Address)) != 0 || bc.GetStake(userWallet.Address).Capacity != dailyBP {
+		t.Errorf("Expected delegation to expire at height 3")
+	}
+
+	if err := bc.AddTransactionToPool(*backendWallet.CreateDelegateTransaction(userWallet.Address, 30, 0, 1)); err != nil {
+		t.Fatalf("Failed to pool delegation: %v", err)
+	}
+	bc.AddBlock(bc.PendingTransactions(), "miner")
+	if err := bc.AddTransactionToPool(*backendWallet.CreateUndelegateTransaction(userWallet.Address, 2)); err != nil {
+		t.Fatalf("Failed to pool undelegation: %v", err)
+	}
+	bc.AddBlock(bc.PendingTransactions(), "miner")
+	if len(bc.GetDelegations(backendWallet.Address)) != 0 {
+		t.Errorf("Expected delegation to be revoked")
+	}
+	if err := bc.AddTransactionToPool(*backendWallet.CreateUndelegateTransaction(userWallet.Address, 3)); err == nil {
+		t.Error("Expected revoking a missing delegation to be rejected")
+	}
+}
+
+func TestSponsoredTransactionChargesFeePayer(t *testing.T) {
+	userWallet := wallet.NewWallet()
+	sponsorWallet := wallet.NewWallet()
+	params := DefaultChainParams()
+	params.GenesisAlloc[sponsorWallet.Address] = 10.0
+	params.GenesisTokens = map[string]map[string]float64{"BERRY_TOKEN": {userWallet.Address: 50.0}}
+	bc := NewBlockchainWithParams(params)
+	bc.BasePower[sponsorWallet.Address] = 0
+
+	unsponsored := userWallet.CreateTransaction("receiver", 20.0, 0)
+	unsponsored.IsTokenTransfer = true
+	unsponsored.TokenID = "BERRY_TOKEN"
+	unsponsored.ExtraPower = 100
+	unsponsored.Signature = userWallet.SignTx(unsponsored)
+	if err := bc.AddTransactionToPool(*unsponsored); err == nil {
+		t.Fatal("Expected a user without UNBT to be rejected")
+	}
+
+	tx := *unsponsored
+	tx.FeePayer = sponsorWallet.Address
+	tx.Signature = userWallet.SignTx(&tx)
+	sponsorWallet.SignAsFeePayer(&tx)
+	if err := bc.AddTransactionToPool(tx); err != nil {
+		t.Fatalf("Failed to pool sponsored tx: %v", err)
+	}
+	bc.AddBlock(bc.PendingTransactions(), "miner")
+
+	receipt, ok := bc.GetReceipt(tx.ID())
+	if !ok || receipt.Status != ReceiptSuccess || receipt.FeePayer != sponsorWallet.Address {
+		t.Fatalf("Expected a successful sponsored receipt, got %+v", receipt)
+	}
+	// No BasePower left: base token fee plus ExtraPower, both in UNBT
+	wantFee := float64(baseTokenPower)/powerPerUNBT + 100*extraPowerCost
+	if math.Abs(receipt.FeeCharged-wantFee) > 1e-12 || math.Abs(bc.Balances[sponsorWallet.Address]-(10.0-wantFee)) > 1e-12 {
+		t.Errorf("Expected sponsor charged %f, receipt %f, balance %f", wantFee, receipt.FeeCharged, bc.Balances[sponsorWallet.Address])
+	}
+	if bc.Balances[userWallet.Address] != 0 || bc.GetTokenBalance("BERRY_TOKEN", "receiver") != 20.0 {
+		t.Errorf("Expected tokens moved from the user without touching its UNBT")
+	}
+	page := bc.GetAddressHistory(sponsorWallet.Address, HistoryQuery{})
+	if len(page.Entries) != 1 || page.Entries[0].Kind != KindSponsorFee {
+		t.Errorf("Expected a sponsor fee entry in the sponsor history, got %+v", page.Entries)
+	}
+}
+
+func TestEstimateFeeOutbidsPoolAndFullBlocks(t *testing.T) {
+	wallets := []*wallet.Wallet{wallet.NewWallet(), wallet.NewWallet(), wallet.NewWallet()}
+	params := DefaultChainParams()
+	params.MaxBlockTxs = 2
+	for _, w := range wallets {
+		params.GenesisAlloc[w.Address] = 10.0
+	}
+	bc := NewBlockchainWithParams(params)
+	for i, extraPower := range []int{5, 20, 10} {
+		tx := wallets[i].CreateTransaction("receiver", 1.0, 0)
+		tx.ExtraPower = extraPower
+		tx.Signature = wallets[i].SignTx(tx)
+		if err := bc.AddTransactionToPool(*tx); err != nil {
+			t.Fatalf("Failed to pool tx: %v", err)
+		}
+	}
+
+	est := bc.EstimateFee(FeeEstimateRequest{Blocks: 1, From: wallets[0].Address})
+	if est.PoolExtraPower != 11 || est.ExtraPower != 11 {
+		t.Errorf("Expected to outbid the second best pool bid with 11, got %+v", est)
+	}
+	if est.BaseFee != 0 || math.Abs(est.TotalCost-11*extraPowerCost) > 1e-12 {
+		t.Errorf("Expected BasePower to cover the base fee, got %+v", est)
+	}
+	if est := bc.EstimateFee(FeeEstimateRequest{Blocks: 2}); est.ExtraPower != 0 || est.BaseFee != baseFee {
+		t.Errorf("Expected no ExtraPower needed within 2 blocks and UNBT base fee without BasePower, got %+v", est)
+	}
+
+	bc.AddBlock(bc.PendingTransactions(), "miner")
+	if len(bc.Chain[1].Transactions) != 2 || len(bc.TransactionPool) != 1 {
+		t.Fatalf("Expected a full block of 2 leaving 1 pooled, got %d and %d", len(bc.Chain[1].Transactions), len(bc.TransactionPool))
+	}
+	est = bc.EstimateFee(FeeEstimateRequest{Blocks: 1, Confidence: 0.5})
+	if est.SampledBlocks != 1 || est.HistoryExtraPower != 11 || est.ExtraPower != 11 {
+		t.Errorf("Expected the full block to require 11 ExtraPower, got %+v", est)
+	}
+}
+
+func TestEventBusPublishesLifecycle(t *testing.T) {
+	senderWallet := wallet.NewWallet()
+	params := DefaultChainParams()
+	params.GenesisAlloc[senderWallet.Address] = 10.0
+	bc := NewBlockchainWithParams(params)
+	all := bc.Subscribe(16)
+	defer all.Unsubscribe()
+	blocks := bc.Subscribe(1, EventBlockImported)
+	defer blocks.Unsubscribe()
+
+	pooled := senderWallet.CreateTransaction("receiver", 1.0, 0)
+	if err := bc.AddTransactionToPool(*pooled); err != nil {
+		t.Fatalf("AddTransactionToPool failed: %v", err)
+	}
+	if err := bc.AddTransactionToPool(*pooled); err == nil {
+		t.Fatal("Expected a reused nonce to be rejected")
+	}
+	// A different transaction with the same nonce evicts the pooled one
+	replacement := senderWallet.CreateTransaction("receiver", 2.0, 0)
+	bc.AddBlock([]transaction.Transaction{*replacement}, "miner")
+	bc.AddBlock([]transaction.Transaction{*senderWallet.CreateTransaction("receiver", 1.0, 1)}, "miner")
+
+	var kinds []EventKind
+	for len(all.C) > 0 {
+		ev := <-all.C
+		kinds = append(kinds, ev.Kind())
+		switch ev := ev.(type) {
+		case TxAccepted:
+			if ev.ID != pooled.ID() || ev.PoolSize != 1 {
+				t.Errorf("Unexpected TxAccepted %+v", ev)
+			}
+		case TxRejected:
+			if ev.Reason == nil {
+				t.Error("Expected TxRejected to carry the reason")
+			}
+		case TxEvicted:
+			if ev.ID != pooled.ID() {
+				t.Errorf("Expected the pooled transaction evicted, got %s", ev.ID)
+			}
+		case BlockImported:
+			if ev.Head.Height != ev.Block.Index {
+				t.Errorf("Expected head at the imported block, got %+v", ev.Head)
+			}
+		}
+	}
+	want := []EventKind{EventTxAccepted, EventTxRejected, EventTxEvicted, EventBlockImported, EventBlockImported}
+	if fmt.Sprint(kinds) != fmt.Sprint(want) {
+		t.Errorf("Expected events %v, got %v", want, kinds)
+	}
+
+	// The full buffer drops the second block instead of blocking the import
+	if len(blocks.C) != 1 || blocks.Dropped() != 1 {
+		t.Errorf("Expected one buffered and one dropped block event, got %d and %d", len(blocks.C), blocks.Dropped())
+	}
+	blocks.Unsubscribe()
+	if _, ok := <-blocks.C; !ok {
+		t.Error("Expected the buffered event to survive Unsubscribe")
+	}
+}
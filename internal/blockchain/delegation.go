@@ -0,0 +1,167 @@
+package blockchain
+
+import (
+	"math"
+	"sort"
+	"unknownberrytrip/internal/transaction"
+)
+
+// Delegation is daily BasePower capacity lent by one address to another
+type Delegation struct {
+	Delegator    string
+	Delegatee    string
+	Amount       int // BasePower per day moved from the delegator to the delegatee
+	ExpiryHeight int // First height the delegation no longer applies at, 0 for never
+}
+
+// ownCapacity returns the daily BasePower address earns by itself: the flat
+// dailyBP plus Params.StakeBPPerUNBT for every staked UNBT
+func (bc *Blockchain) ownCapacity(address string) int {
+	return dailyBP + int(bc.Stakes[address]*bc.Params.StakeBPPerUNBT)
+}
+
+// activeAt reports whether the delegation applies to the block at height
+func (d Delegation) activeAt(height int) bool {
+	return d.ExpiryHeight == 0 || height < d.ExpiryHeight
+}
+
+// delegatedOut returns the capacity address lends to others in the next block
+func (bc *Blockchain) delegatedOut(address string) int {
+	total := 0
+	for _, d := range bc.Delegations[address] {
+		if d.activeAt(len(bc.Chain)) {
+			total += d.Amount
+		}
+	}
+	return total
+}
+
+// delegatedIn returns the capacity lent to address by others in the next block
+func (bc *Blockchain) delegatedIn(address string) int {
+	total := 0
+	for _, delegatees := range bc.Delegations {
+		if d, ok := delegatees[address]; ok && d.activeAt(len(bc.Chain)) {
+			total += d.Amount
+		}
+	}
+	return total
+}
+
+// basePowerCapacity returns the daily BasePower of address: its own capacity minus
+// what it lends plus what it borrows
+func (bc *Blockchain) basePowerCapacity(address string) int {
+	return bc.ownCapacity(address) - bc.delegatedOut(address) + bc.delegatedIn(address)
+}
+
+// checkDelegation validates a delegate or undelegate transaction against the state
+// at height. pendingOut is capacity already lent by pooled transactions.
+func (bc *Blockchain) checkDelegation(tx transaction.Transaction, height, pendingOut int) error {
+	current, exists := bc.Delegations[tx.From][tx.To]
+	if tx.Type == transaction.TxUndelegate {
+		if !exists {
+			return rejectTx(ErrNoDelegation, nil, "no delegation from %s to %s", tx.From, tx.To)
+		}
+		return nil
+	}
+	if tx.ExpiryHeight != 0 && tx.ExpiryHeight <= height {
+		return rejectTx(ErrDelegationExpired, map[string]interface{}{"expiryHeight": tx.ExpiryHeight, "height": height}, "delegation expires at height %d, already reached", tx.ExpiryHeight)
+	}
+	// A new delegation to the same address replaces the current one
+	available := bc.ownCapacity(tx.From) - bc.delegatedOut(tx.From) + current.Amount - pendingOut
+	if int(tx.Amount) > available {
+		return rejectTx(ErrInsufficientCapacity, map[string]interface{}{"required": int(tx.Amount), "available": available}, "insufficient capacity: delegating %d BP, %d BP available", int(tx.Amount), available)
+	}
+	return nil
+}
+
+// checkUnstake makes sure the stake left after unstaking amount still backs the
+// capacity address lends. pending is stake already unstaked by pooled transactions.
+func (bc *Blockchain) checkUnstake(address string, amount, pending float64) error {
+	staked := bc.Stakes[address] - pending
+	if staked < amount {
+		return rejectTx(ErrInsufficientStake, map[string]interface{}{"required": amount, "available": staked}, "insufficient stake: need %f UNBT, have %f", amount, staked)
+	}
+	left := dailyBP + int((staked-amount)*bc.Params.StakeBPPerUNBT)
+	if out := bc.delegatedOut(address); left < out {
+		return rejectTx(ErrInsufficientStake, map[string]interface{}{"delegated": out, "capacityLeft": left}, "stake backs %d BP of delegations, only %d BP would be left", out, left)
+	}
+	return nil
+}
+
+// delegate lends amount of daily capacity from one address to another until
+// expiryHeight. BasePower of both is regenerated at the block timestamp first, so
+// the new capacity only applies from now on.
+func (bc *Blockchain) delegate(from, to string, amount, expiryHeight int, at int64) {
+	bc.updateBasePower(from, at)
+	bc.updateBasePower(to, at)
+	if bc.Delegations[from] == nil {
+		bc.Delegations[from] = make(map[string]Delegation)
+	}
+	bc.Delegations[from][to] = Delegation{Delegator: from, Delegatee: to, Amount: amount, ExpiryHeight: expiryHeight}
+}
+
+// undelegate ends the delegation from one address to another
+func (bc *Blockchain) undelegate(from, to string, at int64) {
+	bc.updateBasePower(from, at)
+	bc.updateBasePower(to, at)
+	delete(bc.Delegations[from], to)
+	if len(bc.Delegations[from]) == 0 {
+		delete(bc.Delegations, from)
+	}
+}
+
+// expireDelegations ends the delegations that expire at the height of block
+func (bc *Blockchain) expireDelegations(block *Block) {
+	for _, d := range bc.sortedDelegations() {
+		if !d.activeAt(block.Index) {
+			bc.undelegate(d.Delegator, d.Delegatee, block.Timestamp)
+			bc.logs.chain.Debug("Delegation expired", "from", d.Delegator, "to", d.Delegatee, "base_power", d.Amount)
+		}
+	}
+}
+
+// sortedDelegations returns every delegation ordered by delegator, then delegatee
+func (bc *Blockchain) sortedDelegations() []Delegation {
+	var all []Delegation
+	for _, delegatees := range bc.Delegations {
+		for _, d := range delegatees {
+			all = append(all, d)
+		}
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Delegator != all[j].Delegator {
+			return all[i].Delegator < all[j].Delegator
+		}
+		return all[i].Delegatee < all[j].Delegatee
+	})
+	return all
+}
+
+// pendingDelegated returns the capacity lent by pooled delegate transactions of address
+func (bc *Blockchain) pendingDelegated(address string) int {
+	pending := 0
+	for _, tx := range bc.pooled(address).sent {
+		if tx.Type == transaction.TxDelegate {
+			pending += int(tx.Amount)
+		}
+	}
+	return pending
+}
+
+// isWholeBP reports whether amount is a positive whole number of BasePower
+func isWholeBP(amount float64) bool {
+	return amount >= 1 && amount == math.Trunc(amount) && amount <= math.MaxInt32
+}
+
+// GetDelegations returns the delegations made by and to address
+func (bc *Blockchain) GetDelegations(address string) []Delegation {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	var result []Delegation
+	for _, d := range bc.sortedDelegations() {
+		if d.Delegator == address || d.Delegatee == address {
+			result = append(result, d)
+		}
+	}
+	return result
+}
@@ -0,0 +1,74 @@
+package blockchain
+
+import "math"
+
+// Supply reports how much UNBT exists and how much may still be created
+type Supply struct {
+	Height      int     // Height the figures are taken at
+	Circulating float64 // Sum of all balances
+	TotalMinted float64 // Genesis allocations plus block rewards paid
+	Remaining   float64 // UNBT that can still be minted, -1 when there is no cap
+	MaxSupply   float64 // Hard cap, 0 when there is none
+	NextReward  float64 // Reward of the next block
+}
+
+// BlockReward returns the UNBT reward of the block at height under the emission
+// schedule, given what has been minted so far
+func (bc *Blockchain) BlockReward(height int) float64 {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.blockReward(height)
+}
+
+// blockReward returns the reward of the block at height given what is minted so far
+func (bc *Blockchain) blockReward(height int) float64 {
+	return bc.Params.rewardAt(height, bc.Minted)
+}
+
+// rewardAt halves InitialReward every HalvingInterval blocks, never going below
+// TailEmission, and clips the result to what MaxSupply still allows after minted
+func (p ChainParams) rewardAt(height int, minted float64) float64 {
+	amount := p.InitialReward
+	if p.HalvingInterval > 0 && height > 0 {
+		halvings := (height - 1) / p.HalvingInterval // Block 1 starts the first era
+		if halvings >= 64 {
+			amount = 0
+		} else {
+			amount = math.Ldexp(amount, -halvings)
+		}
+	}
+	if amount < p.TailEmission {
+		amount = p.TailEmission
+	}
+	if p.MaxSupply > 0 {
+		left := p.MaxSupply - minted
+		if left < 0 {
+			left = 0
+		}
+		if amount > left {
+			amount = left
+		}
+	}
+	return amount
+}
+
+// Supply returns the current supply figures
+func (bc *Blockchain) Supply() Supply {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	s := Supply{
+		Height:      len(bc.Chain) - 1,
+		TotalMinted: bc.Minted,
+		Remaining:   -1,
+		MaxSupply:   bc.Params.MaxSupply,
+		NextReward:  bc.blockReward(len(bc.Chain)),
+	}
+	for _, balance := range bc.Balances {
+		s.Circulating += balance
+	}
+	if bc.Params.MaxSupply > 0 {
+		s.Remaining = math.Max(bc.Params.MaxSupply-bc.Minted, 0)
+	}
+	return s
+}
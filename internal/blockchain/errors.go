@@ -0,0 +1,99 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrStaleBlock       = errors.New("block does not extend the current tip")
+	ErrInvalidProof     = errors.New("block hash does not meet the proof of work")
+	ErrUnknownTemplate  = errors.New("unknown or expired block template")
+	ErrInvalidCoinbase  = errors.New("invalid coinbase")
+	ErrInvalidTimestamp = errors.New("invalid block timestamp")
+	ErrSupplyViolation  = errors.New("supply conservation violated")
+	ErrHalted           = errors.New("chain halted after a supply violation")
+)
+
+// Reasons a transaction is rejected, wrapped in a *TxError
+var (
+	ErrInvalidSignature         = errors.New("invalid signature")
+	ErrInvalidTransaction       = errors.New("invalid transaction")
+	ErrInvalidAmount            = errors.New("invalid amount")
+	ErrNonceTooLow              = errors.New("nonce too low")
+	ErrNonceGap                 = errors.New("nonce gap")
+	ErrInsufficientBalance      = errors.New("insufficient balance")
+	ErrInsufficientTokenBalance = errors.New("insufficient token balance")
+	ErrInsufficientStake        = errors.New("insufficient stake")
+	ErrInsufficientCapacity     = errors.New("insufficient capacity")
+	ErrNoDelegation             = errors.New("no such delegation")
+	ErrDelegationExpired        = errors.New("delegation already expired")
+)
+
+// TxError is a rejected transaction: one of the sentinels above and the values
+// that failed the check, such as the expected nonce or the required amount
+type TxError struct {
+	Err     error                  // Sentinel, matched by errors.Is
+	Msg     string                 // Description, Err's text when empty
+	Details map[string]interface{} // Values behind the rejection, may be nil
+}
+
+func (e *TxError) Error() string {
+	if e.Msg == "" {
+		return e.Err.Error()
+	}
+	return e.Msg
+}
+
+func (e *TxError) Unwrap() error { return e.Err }
+
+// rejectTx builds a *TxError for sentinel with a formatted description
+func rejectTx(sentinel error, details map[string]interface{}, format string, args ...interface{}) error {
+	return &TxError{Err: sentinel, Msg: fmt.Sprintf(format, args...), Details: details}
+}
+
+// errorCodes are the stable codes of the sentinels, most specific first
+var errorCodes = []struct {
+	err  error
+	code string
+}{
+	{ErrHalted, "CHAIN_HALTED"},
+	{ErrInvalidSignature, "INVALID_SIGNATURE"},
+	{ErrInvalidAmount, "INVALID_AMOUNT"},
+	{ErrInvalidTransaction, "INVALID_TRANSACTION"},
+	{ErrNonceTooLow, "NONCE_TOO_LOW"},
+	{ErrNonceGap, "NONCE_GAP"},
+	{ErrInsufficientBalance, "INSUFFICIENT_BALANCE"},
+	{ErrInsufficientTokenBalance, "INSUFFICIENT_TOKEN_BALANCE"},
+	{ErrInsufficientStake, "INSUFFICIENT_STAKE"},
+	{ErrInsufficientCapacity, "INSUFFICIENT_CAPACITY"},
+	{ErrNoDelegation, "NO_DELEGATION"},
+	{ErrDelegationExpired, "DELEGATION_EXPIRED"},
+	{ErrStaleBlock, "STALE_BLOCK"},
+	{ErrInvalidProof, "INVALID_PROOF"},
+	{ErrUnknownTemplate, "UNKNOWN_TEMPLATE"},
+	{ErrInvalidCoinbase, "INVALID_COINBASE"},
+	{ErrInvalidTimestamp, "INVALID_TIMESTAMP"},
+	{ErrSupplyViolation, "SUPPLY_VIOLATION"},
+}
+
+// ErrorCode returns the stable code of the sentinel err wraps, such as
+// NONCE_TOO_LOW, or "" when it wraps none
+func ErrorCode(err error) string {
+	for _, c := range errorCodes {
+		if errors.Is(err, c.err) {
+			return c.code
+		}
+	}
+	return ""
+}
+
+// ErrorDetails returns the values behind a rejected transaction, nil when err
+// carries none
+func ErrorDetails(err error) map[string]interface{} {
+	var txErr *TxError
+	if errors.As(err, &txErr) {
+		return txErr.Details
+	}
+	return nil
+}
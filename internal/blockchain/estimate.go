@@ -0,0 +1,113 @@
+package blockchain
+
+import (
+	"math"
+	"sort"
+	"unknownberrytrip/internal/transaction"
+)
+
+// feeHistoryBlocks is how many recent blocks the fee estimator samples
+const feeHistoryBlocks = 50
+
+// FeeEstimateRequest asks how much ExtraPower a transaction needs
+type FeeEstimateRequest struct {
+	Blocks          int     // Include the transaction within this many blocks, default 1
+	Confidence      float64 // Probability of inclusion in (0, 1), default 0.9
+	From            string  // Fee payer, used to tell whether BasePower covers the base fee; empty assumes none
+	IsTokenTransfer bool    // Token transfers need more BasePower
+}
+
+// FeeEstimate is the ExtraPower recommended for a transaction and what it costs
+type FeeEstimate struct {
+	Blocks             int
+	Confidence         float64
+	ExtraPower         int     // Recommended ExtraPower
+	ExtraPowerCost     float64 // UNBT paid for the ExtraPower
+	PoolExtraPower     int     // ExtraPower needed to outbid the pool for the next Blocks blocks
+	HistoryExtraPower  int     // ExtraPower recent blocks admitted with the requested confidence
+	BasePowerRequired  int     // BasePower covering the base fee
+	BasePowerAvailable int     // BasePower From has left after its pooled transactions
+	BaseFee            float64 // UNBT paid for the base fee when BasePower falls short, else 0
+	TotalCost          float64 // UNBT paid in total: base fee plus ExtraPower
+	PoolSize           int     // Transactions waiting in the pool
+	BlockCapacity      int     // Transactions per block, 0 when unlimited
+	SampledBlocks      int     // Recent blocks used for HistoryExtraPower
+}
+
+// EstimateFee recommends the ExtraPower for inclusion within req.Blocks blocks with
+// probability req.Confidence. The recommendation outbids the pool transactions that
+// already fill those blocks, and the ExtraPower that recent full blocks admitted:
+// a block admits a bid above the lowest ExtraPower it included, or any bid when
+// it was not full.
+func (bc *Blockchain) EstimateFee(req FeeEstimateRequest) FeeEstimate {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	if req.Blocks <= 0 {
+		req.Blocks = 1
+	}
+	if !(req.Confidence > 0 && req.Confidence < 1) {
+		req.Confidence = 0.9
+	}
+	capacity := bc.Params.MaxBlockTxs
+	est := FeeEstimate{
+		Blocks:        req.Blocks,
+		Confidence:    req.Confidence,
+		PoolSize:      len(bc.TransactionPool),
+		BlockCapacity: capacity,
+	}
+
+	if capacity > 0 {
+		// Pool transactions mined ahead of a new one: the best bids that fit in the
+		// requested blocks. Bidding above the last of them takes its place.
+		if slots := capacity * req.Blocks; len(bc.TransactionPool) >= slots {
+			ordered := orderByPriority(bc.TransactionPool)
+			est.PoolExtraPower = ordered[slots-1].ExtraPower + 1
+		}
+
+		var admits []int // Lowest bid each recent block admitted
+		for i := len(bc.Chain) - 1; i > 0 && len(admits) < feeHistoryBlocks; i-- {
+			block := bc.Chain[i]
+			admit := 0
+			if len(block.Transactions) >= capacity {
+				admit = math.MaxInt32
+				for _, tx := range block.Transactions {
+					if tx.ExtraPower < admit {
+						admit = tx.ExtraPower
+					}
+				}
+				admit++
+			}
+			admits = append(admits, admit)
+		}
+		est.SampledBlocks = len(admits)
+		if len(admits) > 0 {
+			// Each block must admit the bid with probability q so that one of the
+			// next Blocks blocks does with the requested confidence
+			q := 1 - math.Pow(1-req.Confidence, 1/float64(req.Blocks))
+			sort.Ints(admits)
+			k := int(math.Ceil(q*float64(len(admits)))) - 1
+			if k < 0 {
+				k = 0
+			}
+			est.HistoryExtraPower = admits[k]
+		}
+	}
+
+	est.ExtraPower = est.PoolExtraPower
+	if est.HistoryExtraPower > est.ExtraPower {
+		est.ExtraPower = est.HistoryExtraPower
+	}
+	tx := transaction.Transaction{ExtraPower: est.ExtraPower, IsTokenTransfer: req.IsTokenTransfer}
+	est.ExtraPowerCost = float64(est.ExtraPower) * extraPowerCost
+	est.BasePowerRequired, _ = txCost(tx, math.MaxInt32)
+	if req.From != "" {
+		est.BasePowerAvailable, _ = bc.pendingCosts(req.From, bc.nextBlockTime())
+	}
+	used, total := txCost(tx, est.BasePowerAvailable)
+	if used == 0 {
+		est.BaseFee = total - est.ExtraPowerCost
+	}
+	est.TotalCost = total
+	return est
+}
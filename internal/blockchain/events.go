@@ -0,0 +1,181 @@
+package blockchain
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+	"unknownberrytrip/internal/transaction"
+)
+
+// EventKind identifies the type of an event
+type EventKind string
+
+const (
+	EventTxAccepted    EventKind = "txAccepted"    // TxAccepted
+	EventTxRejected    EventKind = "txRejected"    // TxRejected
+	EventTxEvicted     EventKind = "txEvicted"     // TxEvicted
+	EventBlockImported EventKind = "blockImported" // BlockImported
+	EventBlockRejected EventKind = "blockRejected" // BlockRejected
+	EventReorg         EventKind = "reorg"         // Reorg
+	EventMiningStarted EventKind = "miningStarted" // MiningStarted
+	EventMiningStopped EventKind = "miningStopped" // MiningStopped
+	EventChainHalted   EventKind = "chainHalted"   // ChainHalted
+)
+
+// Event is published on the event bus of a blockchain. Its dynamic type is the
+// struct named by its kind. Blocks and transactions are shared with the chain and
+// must not be modified.
+type Event interface {
+	Kind() EventKind
+}
+
+// TxAccepted is published when a transaction enters the pool
+type TxAccepted struct {
+	ID       string
+	Tx       *transaction.Transaction
+	PoolSize int // Pool size including the transaction
+}
+
+// TxRejected is published when the pool refuses a transaction
+type TxRejected struct {
+	ID     string
+	Tx     *transaction.Transaction
+	Reason error
+}
+
+// TxEvicted is published when a pooled transaction is dropped without being
+// included, because a block used its nonce
+type TxEvicted struct {
+	ID     string
+	Tx     *transaction.Transaction
+	Reason string
+}
+
+// BlockImported is published when a block is appended to the chain
+type BlockImported struct {
+	Block *Block
+	Head  ChainHead // Tip after the block
+}
+
+// BlockRejected is published when a mined or submitted block fails to import
+type BlockRejected struct {
+	Block  *Block
+	Reason error
+}
+
+// Reorg reports a switch of the tip to a competing branch. The chain has no fork
+// choice yet, blocks not extending the tip are rejected as stale, so it is not
+// published today; subscribers can handle it ahead of fork support.
+type Reorg struct {
+	OldHead ChainHead
+	NewHead ChainHead
+	Depth   int // Blocks removed from the old branch
+}
+
+// MiningStarted is published when a mining loop starts
+type MiningStarted struct {
+	Miner    string
+	Interval time.Duration
+}
+
+// MiningStopped is published when a mining loop exits
+type MiningStopped struct {
+	Miner string
+}
+
+// ChainHalted is published when a supply violation halts the chain
+type ChainHalted struct {
+	Reason error
+}
+
+func (TxAccepted) Kind() EventKind    { return EventTxAccepted }
+func (TxRejected) Kind() EventKind    { return EventTxRejected }
+func (TxEvicted) Kind() EventKind     { return EventTxEvicted }
+func (BlockImported) Kind() EventKind { return EventBlockImported }
+func (BlockRejected) Kind() EventKind { return EventBlockRejected }
+func (Reorg) Kind() EventKind         { return EventReorg }
+func (MiningStarted) Kind() EventKind { return EventMiningStarted }
+func (MiningStopped) Kind() EventKind { return EventMiningStopped }
+func (ChainHalted) Kind() EventKind   { return EventChainHalted }
+
+// Subscription receives the events of its kinds published after it was created.
+// Events are delivered through a buffer and dropped when it is full, so a slow
+// subscriber never stalls the chain.
+type Subscription struct {
+	C       <-chan Event
+	ch      chan Event
+	kinds   map[EventKind]bool // Nil for every kind
+	bus     *eventBus
+	dropped atomic.Int64
+	once    sync.Once
+}
+
+// Dropped returns the number of events lost because the buffer was full
+func (s *Subscription) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// Unsubscribe stops the delivery of events and closes C
+func (s *Subscription) Unsubscribe() {
+	s.once.Do(func() {
+		s.bus.mu.Lock()
+		delete(s.bus.subs, s)
+		s.bus.mu.Unlock()
+		close(s.ch)
+	})
+}
+
+// eventBus fans events out to subscriptions
+type eventBus struct {
+	mu   sync.Mutex
+	subs map[*Subscription]struct{}
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{subs: make(map[*Subscription]struct{})}
+}
+
+// publish delivers ev to every subscription of its kind without blocking
+func (b *eventBus) publish(ev Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range b.subs {
+		if sub.kinds != nil && !sub.kinds[ev.Kind()] {
+			continue
+		}
+		select {
+		case sub.ch <- ev:
+		default:
+			sub.dropped.Add(1)
+		}
+	}
+}
+
+// Subscribe returns a subscription to the chain events of the given kinds, or of
+// every kind when none is given, with room for buffer undelivered events
+func (bc *Blockchain) Subscribe(buffer int, kinds ...EventKind) *Subscription {
+	ch := make(chan Event, buffer)
+	sub := &Subscription{C: ch, ch: ch, bus: bc.events}
+	if len(kinds) > 0 {
+		sub.kinds = make(map[EventKind]bool, len(kinds))
+		for _, kind := range kinds {
+			sub.kinds[kind] = true
+		}
+	}
+	bc.events.mu.Lock()
+	bc.events.subs[sub] = struct{}{}
+	bc.events.mu.Unlock()
+	return sub
+}
+
+// Hook calls fn on its own goroutine for every event of the given kinds until the
+// returned subscription is cancelled
+func (bc *Blockchain) Hook(buffer int, fn func(Event), kinds ...EventKind) *Subscription {
+	sub := bc.Subscribe(buffer, kinds...)
+	go func() {
+		for ev := range sub.C {
+			fn(ev)
+		}
+	}()
+	return sub
+}
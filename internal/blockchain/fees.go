@@ -0,0 +1,54 @@
+package blockchain
+
+// FeeSummary accounts for the UNBT fees collected by a block
+type FeeSummary struct {
+	Total           float64 // Fees charged to senders
+	Miner           float64 // Paid through the coinbase
+	Treasury        float64 // Credited to TreasuryAddress
+	TreasuryAddress string  // Treasury at the time of the block
+	Burned          float64 // Destroyed
+}
+
+// splitFees divides total fees between miner, treasury and burn. Whatever is not
+// given to the miner or the treasury is burned, so the parts always add up to the total.
+func (bc *Blockchain) splitFees(total float64) FeeSummary {
+	s := FeeSummary{Total: total}
+	minerShare := clampShare(bc.Params.FeeMinerShare)
+	treasuryShare := 0.0
+	if bc.Params.TreasuryAddress != "" {
+		treasuryShare = clampShare(bc.Params.FeeTreasuryShare)
+		if minerShare+treasuryShare > 1 {
+			treasuryShare = 1 - minerShare
+		}
+	}
+	s.Miner = s.Total * minerShare
+	s.Treasury = s.Total * treasuryShare
+	if s.Treasury > 0 {
+		s.TreasuryAddress = bc.Params.TreasuryAddress
+	}
+	s.Burned = s.Total - s.Miner - s.Treasury
+	return s
+}
+
+// payFees credits the treasury share and records the burned share
+func (bc *Blockchain) payFees(s FeeSummary) {
+	if s.Treasury > 0 {
+		bc.Balances[s.TreasuryAddress] += s.Treasury
+		bc.logs.chain.Debug("Treasury credited", "address", s.TreasuryAddress, "amount", s.Treasury)
+	}
+	if s.Burned > 0 {
+		bc.Burned += s.Burned
+		bc.logs.chain.Debug("Fees burned", "amount", s.Burned)
+	}
+}
+
+// clampShare limits a fee share to [0, 1]
+func clampShare(share float64) float64 {
+	if share < 0 {
+		return 0
+	}
+	if share > 1 {
+		return 1
+	}
+	return share
+}
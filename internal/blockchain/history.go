@@ -0,0 +1,189 @@
+package blockchain
+
+import "unknownberrytrip/internal/transaction"
+
+// HistoryDirection tells whether an entry moved value into or out of an address
+type HistoryDirection string
+
+const (
+	DirectionIn  HistoryDirection = "in"
+	DirectionOut HistoryDirection = "out"
+)
+
+// HistoryKind is the type of activity recorded in the address history
+type HistoryKind string
+
+const (
+	KindTransfer      HistoryKind = "transfer"
+	KindTokenTransfer HistoryKind = "token_transfer"
+	KindReward        HistoryKind = "reward"
+	KindFee           HistoryKind = "fee" // Treasury share of block fees
+	KindStake         HistoryKind = "stake"
+	KindUnstake       HistoryKind = "unstake"
+	KindUnbonded      HistoryKind = "unbonded" // Unstaked UNBT released to the balance
+	KindDelegate      HistoryKind = "delegate" // Amount is BasePower per day
+	KindUndelegate    HistoryKind = "undelegate"
+	KindSponsorFee    HistoryKind = "sponsor_fee" // Fee paid for another sender's transaction
+)
+
+// HistoryEntry is one movement of value affecting an address
+type HistoryEntry struct {
+	BlockHeight  int              // Block containing the activity
+	Index        int              // Transaction position in the block, -1 for rewards, fees and releases
+	TxID         string           // Transaction ID, empty for rewards and fees
+	Kind         HistoryKind      // Transfer, token transfer, staking, delegation, reward or fee
+	Direction    HistoryDirection // In or out
+	Counterparty string           // Other side of the transfer, empty for rewards and fees
+	Amount       float64          // Amount moved
+	TokenID      string           // Token ID for token transfers
+	Fee          float64          // UNBT fee paid, outgoing entries only
+	Status       ReceiptStatus    // Execution status of the transaction
+}
+
+// HistoryQuery selects a page of address history
+type HistoryQuery struct {
+	Direction  HistoryDirection // Empty for both directions
+	FromHeight int              // Lowest block height, inclusive
+	ToHeight   int              // Highest block height, inclusive; 0 for the tip
+	Limit      int              // Maximum number of entries, 0 for no limit
+}
+
+// HistoryPage is a page of address history, newest first
+type HistoryPage struct {
+	Entries    []HistoryEntry
+	NextHeight int // ToHeight of the next (older) page, -1 when there is none
+}
+
+// GetAddressHistory returns the activity of an address, newest first. Pages end on
+// a block boundary, so a page may exceed Limit when a single block holds more entries.
+func (bc *Blockchain) GetAddressHistory(address string, q HistoryQuery) HistoryPage {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	toHeight := q.ToHeight
+	if toHeight <= 0 {
+		toHeight = len(bc.Chain) - 1
+	}
+
+	page := HistoryPage{NextHeight: -1}
+	entries := bc.history[address]
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if entry.BlockHeight > toHeight {
+			continue
+		}
+		if entry.BlockHeight < q.FromHeight {
+			break
+		}
+		if q.Direction != "" && entry.Direction != q.Direction {
+			continue
+		}
+		if q.Limit > 0 && len(page.Entries) >= q.Limit {
+			last := page.Entries[len(page.Entries)-1].BlockHeight
+			if entry.BlockHeight != last {
+				page.NextHeight = last - 1
+				break
+			}
+		}
+		page.Entries = append(page.Entries, entry)
+	}
+	return page
+}
+
+// indexHistory appends the activity of a block to the address history; blocks
+// are indexed as they are imported, so reads never build it
+func (bc *Blockchain) indexHistory(block *Block) {
+	for i, tx := range block.Transactions {
+		kind := KindTransfer
+		switch {
+		case tx.IsTokenTransfer:
+			kind = KindTokenTransfer
+		case tx.Type == transaction.TxStake:
+			kind = KindStake
+		case tx.Type == transaction.TxUnstake:
+			kind = KindUnstake
+		case tx.Type == transaction.TxDelegate:
+			kind = KindDelegate
+		case tx.Type == transaction.TxUndelegate:
+			kind = KindUndelegate
+		}
+		status := ReceiptSuccess
+		fee := 0.0
+		if i < len(block.Receipts) {
+			status = block.Receipts[i].Status
+			fee = block.Receipts[i].FeeCharged
+		}
+		id := tx.ID()
+		if tx.FeePayer != "" {
+			bc.history[tx.FeePayer] = append(bc.history[tx.FeePayer], HistoryEntry{
+				BlockHeight:  block.Index,
+				Index:        i,
+				TxID:         id,
+				Kind:         KindSponsorFee,
+				Direction:    DirectionOut,
+				Counterparty: tx.From,
+				Fee:          fee,
+				Status:       status,
+			})
+			fee = 0
+		}
+		bc.history[tx.From] = append(bc.history[tx.From], HistoryEntry{
+			BlockHeight:  block.Index,
+			Index:        i,
+			TxID:         id,
+			Kind:         kind,
+			Direction:    DirectionOut,
+			Counterparty: tx.To,
+			Amount:       tx.Amount,
+			TokenID:      tx.TokenID,
+			Fee:          fee,
+			Status:       status,
+		})
+		if status != ReceiptSuccess || kind == KindStake || kind == KindUnstake {
+			continue
+		}
+		bc.history[tx.To] = append(bc.history[tx.To], HistoryEntry{
+			BlockHeight:  block.Index,
+			Index:        i,
+			TxID:         id,
+			Kind:         kind,
+			Direction:    DirectionIn,
+			Counterparty: tx.From,
+			Amount:       tx.Amount,
+			TokenID:      tx.TokenID,
+			Status:       status,
+		})
+	}
+	for _, payout := range block.Unbonded {
+		bc.history[payout.Address] = append(bc.history[payout.Address], HistoryEntry{
+			BlockHeight: block.Index,
+			Index:       -1,
+			Kind:        KindUnbonded,
+			Direction:   DirectionIn,
+			Amount:      payout.Amount,
+			Status:      ReceiptSuccess,
+		})
+	}
+	for _, payout := range block.Rewards {
+		bc.history[payout.Address] = append(bc.history[payout.Address], HistoryEntry{
+			BlockHeight: block.Index,
+			Index:       -1,
+			Kind:        KindReward,
+			Direction:   DirectionIn,
+			Amount:      payout.Amount,
+			Status:      ReceiptSuccess,
+		})
+	}
+	if block.Fees.Treasury > 0 {
+		address := block.Fees.TreasuryAddress
+		bc.history[address] = append(bc.history[address], HistoryEntry{
+			BlockHeight: block.Index,
+			Index:       -1,
+			Kind:        KindFee,
+			Direction:   DirectionIn,
+			Amount:      block.Fees.Treasury,
+			Status:      ReceiptSuccess,
+		})
+	}
+	bc.historyHeight = block.Index
+}
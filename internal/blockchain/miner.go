@@ -0,0 +1,122 @@
+package blockchain
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"math"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unknownberrytrip/internal/logging"
+)
+
+// hashBatch is how many nonces a worker tries between checks for cancellation
+const hashBatch = 4096
+
+// Miner searches for a block nonce on several goroutines. Worker i tries nonces
+// i, i+n, i+2n... so the nonce space is split without coordination.
+type Miner struct {
+	workers  int
+	hashes   atomic.Uint64 // Hashes computed over the miner's lifetime
+	hashrate atomic.Uint64 // Float64 bits of the hashes per second of the last run
+	log      *logging.Logger
+}
+
+// NewMiner creates a miner with the given number of workers, 0 for one per CPU
+func NewMiner(workers int) *Miner {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	return &Miner{workers: workers, log: logging.Default().Component("pow")}
+}
+
+// SetLogger sets the logger of the miner
+func (m *Miner) SetLogger(l *logging.Logger) {
+	m.log = l
+}
+
+// Hashrate returns the hashes per second measured during the last mining run
+func (m *Miner) Hashrate() float64 {
+	return math.Float64frombits(m.hashrate.Load())
+}
+
+// TotalHashes returns the number of hashes computed by the miner
+func (m *Miner) TotalHashes() uint64 {
+	return m.hashes.Load()
+}
+
+// Mine searches for a nonce meeting the difficulty and sets Nonce and Hash on the
+// block. It returns the context error if ctx is done first, leaving the block unchanged.
+func (m *Miner) Mine(ctx context.Context, b *Block) error {
+	nonce, hash, err := m.MineHeader(ctx, b.headerPrefix(), difficulty)
+	if err != nil {
+		m.log.Debug("Mining aborted", "height", b.Index, "reason", err)
+		return err
+	}
+	b.Nonce = int(nonce)
+	b.Hash = hexHash(hash)
+	m.log.Info("Block mined", "height", b.Index, "hash", b.Hash, "nonce", b.Nonce, "hashrate", math.Round(m.Hashrate()))
+	return nil
+}
+
+// MineHeader searches for a nonce such that SHA-256 of the header prefix followed by
+// the big-endian nonce starts with zeros hex zero digits
+func (m *Miner) MineHeader(ctx context.Context, prefix []byte, zeros int) (uint64, [32]byte, error) {
+	return m.Search(ctx, prefix, 0, func(hash [32]byte) bool {
+		return meetsTarget(hash[:], zeros)
+	})
+}
+
+// Search tries nonces from start upwards until accept returns true for the header
+// hash and returns that nonce. Pool miners use it with a share target and the
+// nonce range assigned by the pool.
+func (m *Miner) Search(ctx context.Context, prefix []byte, start uint64, accept func(hash [32]byte) bool) (uint64, [32]byte, error) {
+	began := time.Now()
+	var hashes atomic.Uint64
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var once sync.Once
+	var found uint64
+	var foundHash [32]byte
+	var wg sync.WaitGroup
+	for i := 0; i < m.workers; i++ {
+		wg.Add(1)
+		go func(first uint64) {
+			defer wg.Done()
+			buf := make([]byte, len(prefix)+8)
+			copy(buf, prefix)
+			stride := uint64(m.workers)
+			for nonce := first; ctx.Err() == nil; {
+				for n := 0; n < hashBatch; n++ {
+					binary.BigEndian.PutUint64(buf[len(prefix):], nonce)
+					sum := sha256.Sum256(buf)
+					if accept(sum) {
+						hashes.Add(uint64(n + 1))
+						once.Do(func() {
+							found, foundHash = nonce, sum
+							cancel()
+						})
+						return
+					}
+					nonce += stride
+				}
+				hashes.Add(hashBatch)
+			}
+		}(start + uint64(i))
+	}
+	wg.Wait()
+
+	total := hashes.Load()
+	m.hashes.Add(total)
+	elapsed := time.Since(began).Seconds()
+	if elapsed > 0 {
+		m.hashrate.Store(math.Float64bits(float64(total) / elapsed))
+	}
+
+	var err error
+	once.Do(func() { err = context.Cause(ctx) })
+	return found, foundHash, err
+}
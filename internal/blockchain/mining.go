@@ -1,40 +1,88 @@
 package blockchain
 
 import (
-	"fmt"
+	"context"
 	"sort"
 	"time"
 	"unknownberrytrip/internal/transaction"
 )
 
-func (bc *Blockchain) StartMining(minerAddress string) {
-	ticker := time.NewTicker(10 * time.Second)
-	go func() {
-		for range ticker.C {
-			var transactions []transaction.Transaction
-			bc.mu.Lock() // Lock for read pool and create block
-			if len(bc.TransactionPool) > 0 {
-				fmt.Printf("[Mining] Started: %d transactions in pool\n", len(bc.TransactionPool))
-				transactions = bc.TransactionPool
-				// Sort by ExtraPower for priority processing
-				sort.Slice(transactions, func(i, j int) bool {
-					return transactions[i].ExtraPower > transactions[j].ExtraPower
-				})
-				bc.TransactionPool = []transaction.Transaction{}
-			} else {
-				fmt.Println("[Mining] Tick: No transactions in pool")
-				bc.mu.Unlock()
+// MiningInterval is the default time between mining attempts
+const MiningInterval = 10 * time.Second
+
+// RunMining mines a block from the pool every interval until ctx is done. A block
+// being mined when ctx is cancelled is abandoned and its transactions stay pooled.
+func (bc *Blockchain) RunMining(ctx context.Context, minerAddress string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	bc.logs.mining.Info("Mining started", "miner", minerAddress, "interval", interval)
+	bc.events.publish(MiningStarted{Miner: minerAddress, Interval: interval})
+	for {
+		select {
+		case <-ctx.Done():
+			bc.logs.mining.Info("Mining stopped", "miner", minerAddress)
+			bc.events.publish(MiningStopped{Miner: minerAddress})
+			return
+		case <-ticker.C:
+		}
+
+		// Sorted by ExtraPower for priority processing
+		transactions := bc.PendingTransactions()
+		if len(transactions) == 0 {
+			bc.logs.mining.Debug("No transactions in pool")
+			continue
+		}
+		height := bc.Height() + 1
+
+		bc.logs.mining.Debug("Mining block", "height", height, "pool_size", len(transactions))
+		if err := bc.AddBlockContext(ctx, transactions, minerAddress); err != nil {
+			bc.logs.mining.Warn("Block not added", "height", height, "reason", err)
+			continue
+		}
+	}
+}
+
+// orderByPriority orders transactions by ExtraPower, highest first, while keeping
+// the transactions of each sender in nonce order
+func orderByPriority(txs []transaction.Transaction) []transaction.Transaction {
+	ordered := make([]transaction.Transaction, 0, len(txs))
+	for _, i := range priorityOrder(txs) {
+		ordered = append(ordered, txs[i])
+	}
+	return ordered
+}
+
+// priorityOrder returns the indexes of txs in the order orderByPriority puts them
+func priorityOrder(txs []transaction.Transaction) []int {
+	bySender := make(map[string][]int)
+	var senders []string
+	for i, tx := range txs {
+		if _, ok := bySender[tx.From]; !ok {
+			senders = append(senders, tx.From)
+		}
+		bySender[tx.From] = append(bySender[tx.From], i)
+	}
+	for _, sender := range senders {
+		queue := bySender[sender]
+		sort.SliceStable(queue, func(i, j int) bool {
+			return txs[queue[i]].Nonce < txs[queue[j]].Nonce
+		})
+	}
+
+	order := make([]int, 0, len(txs))
+	for len(order) < len(txs) {
+		best := ""
+		for _, sender := range senders {
+			queue := bySender[sender]
+			if len(queue) == 0 {
 				continue
 			}
-			prevBlock := bc.Chain[len(bc.Chain)-1]
-			fmt.Printf("[Mining] Creating new block #%d...\n", prevBlock.Index+1)
-			newBlock := NewBlock(transactions, prevBlock, minerAddress)
-			fmt.Printf("[Mining] Block #%d mined successfully with hash: %s, nonce: %d\n", newBlock.Index, newBlock.Hash, newBlock.Nonce)
-			bc.mu.Unlock() // Unlock before AddBlock
-
-			fmt.Println("[Mining] Adding block to blockchain...")
-			bc.AddBlock(transactions, minerAddress)
-			fmt.Printf("[Mining] New block #%d added with %d transactions\n", newBlock.Index, len(transactions))
+			if best == "" || txs[queue[0]].ExtraPower > txs[bySender[best][0]].ExtraPower {
+				best = sender
+			}
 		}
-	}()
+		order = append(order, bySender[best][0])
+		bySender[best] = bySender[best][1:]
+	}
+	return order
 }
@@ -0,0 +1,34 @@
+package blockchain
+
+// ChainParams holds the consensus parameters of the chain
+type ChainParams struct {
+	IncludeFailedTxs bool                          // Keep transactions that fail execution in blocks (fee is still charged)
+	GenesisAlloc     map[string]float64            // UNBT balances created with the genesis block
+	GenesisTokens    map[string]map[string]float64 // Token balances created with the genesis block, by token ID
+	InitialReward    float64                       // Block reward in UNBT before the first halving
+	HalvingInterval  int                           // Blocks between reward halvings, 0 for none
+	TailEmission     float64                       // Reward floor once halvings go below it, 0 for none
+	MaxSupply        float64                       // Hard cap on UNBT ever created, 0 for none
+	FeeMinerShare    float64                       // Fraction of fees paid to the miner in the coinbase
+	FeeTreasuryShare float64                       // Fraction of fees paid to TreasuryAddress
+	TreasuryAddress  string                        // Treasury receiving fees, empty burns its share
+	StakeBPPerUNBT   float64                       // Daily BasePower added per staked UNBT
+	UnbondingPeriod  int                           // Blocks before unstaked UNBT is spendable again
+	MaxBlockTxs      int                           // Transactions a block may hold, 0 for no limit
+	// Fees not paid to the miner or the treasury are burned
+}
+
+// DefaultChainParams returns the parameters used by NewBlockchain
+func DefaultChainParams() ChainParams {
+	return ChainParams{
+		IncludeFailedTxs: true,
+		GenesisAlloc:     map[string]float64{"genesis_miner": reward},
+		InitialReward:    reward,
+		HalvingInterval:  100000,
+		MaxSupply:        reward + 2*reward*100000, // Genesis plus the limit of the halving series
+		FeeMinerShare:    1,
+		StakeBPPerUNBT:   10,
+		UnbondingPeriod:  100,
+		MaxBlockTxs:      1000,
+	}
+}
@@ -1,18 +1,39 @@
 package blockchain
 
 import (
-	"fmt"
+	"context"
+	"encoding/hex"
 	"strings"
 )
 
-const difficulty = 2
+const difficulty = 2 // Leading zero hex digits required in a block hash
 
 // MineBlock performs the Proof of Work to mine the block
 func (b *Block) MineBlock() {
-	target := strings.Repeat("0", difficulty)
-	for !strings.HasPrefix(b.Hash, target) {
-		b.Nonce++
-		b.Hash = b.CalculateHash()
+	b.MineBlockContext(context.Background())
+}
+
+// MineBlockContext performs the Proof of Work on all cores, giving up when ctx is done
+func (b *Block) MineBlockContext(ctx context.Context) error {
+	return NewMiner(0).Mine(ctx, b)
+}
+
+// HasValidProof reports whether the block hash is correct and meets the difficulty
+func (b *Block) HasValidProof() bool {
+	return b.Hash == b.CalculateHash() && strings.HasPrefix(b.Hash, strings.Repeat("0", difficulty))
+}
+
+// meetsTarget reports whether a hash starts with the required number of zero hex digits
+func meetsTarget(hash []byte, zeros int) bool {
+	for i := 0; i < zeros/2; i++ {
+		if hash[i] != 0 {
+			return false
+		}
 	}
-	fmt.Printf("[POW] Block #%d mined successfully with hash: %s, nonce: %d\n", b.Index, b.Hash, b.Nonce)
+	return zeros%2 == 0 || hash[zeros/2] < 0x10
+}
+
+// hexHash encodes a header hash the way it is stored in Block.Hash
+func hexHash(hash [32]byte) string {
+	return hex.EncodeToString(hash[:])
 }
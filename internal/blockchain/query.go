@@ -0,0 +1,192 @@
+package blockchain
+
+import "unknownberrytrip/internal/transaction"
+
+// Page sizes for block and pool listings
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// pageLimit applies the default and maximum page size to a requested limit
+func pageLimit(limit int) int {
+	if limit <= 0 {
+		return defaultPageLimit
+	}
+	if limit > maxPageLimit {
+		return maxPageLimit
+	}
+	return limit
+}
+
+// ChainHead summarizes the tip of the chain
+type ChainHead struct {
+	Height    int
+	Hash      string
+	PrevHash  string
+	Timestamp int64
+	TxCount   int // Transactions in the tip block
+	PoolSize  int // Transactions waiting in the pool
+}
+
+// BlockQuery selects a page of blocks, newest first
+type BlockQuery struct {
+	Before int // Return blocks below this height, 0 to start at the tip
+	Limit  int // Maximum number of blocks, default 20, at most 100
+}
+
+// BlockPage is a page of blocks, newest first
+type BlockPage struct {
+	Blocks     []*Block
+	NextBefore int // Before of the next (older) page, 0 when there is none
+}
+
+// PooledTransaction is a transaction waiting in the pool
+type PooledTransaction struct {
+	ID          string
+	Transaction transaction.Transaction
+}
+
+// MempoolPage is a page of the pool in mining order
+type MempoolPage struct {
+	Total        int // Transactions in the pool
+	Offset       int
+	Transactions []PooledTransaction
+}
+
+// AccountState is the confirmed state of an address and its view with the pool applied
+type AccountState struct {
+	Address           string
+	Balance           float64            // Confirmed UNBT balance
+	Nonce             int                // Transactions confirmed from the address
+	BasePower         int                // BasePower available to the next block, before pooled transactions
+	BasePowerCapacity int                // Daily BasePower, stake and delegations included
+	Staked            float64            // UNBT staked
+	TokenBalances     map[string]float64 // Confirmed token balances by token ID
+	Pending           PendingAccount     // Account once the pool is mined
+}
+
+// PendingAccount is what an address can still spend once its pooled transactions are mined
+type PendingAccount struct {
+	Transactions  int                // Pooled transactions sent by the address
+	Nonce         int                // Nonce of the next transaction
+	Balance       float64            // UNBT left after pooled amounts and fees
+	BasePower     int                // BasePower left after pooled transactions
+	TokenBalances map[string]float64 // Token balances left after pooled transfers
+}
+
+// Head returns a summary of the tip block
+func (bc *Blockchain) Head() ChainHead {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.headLocked()
+}
+
+// headLocked summarizes the tip; the caller holds bc.mu
+func (bc *Blockchain) headLocked() ChainHead {
+	tip := bc.Chain[len(bc.Chain)-1]
+	return ChainHead{
+		Height:    tip.Index,
+		Hash:      tip.Hash,
+		PrevHash:  tip.PrevHash,
+		Timestamp: tip.Timestamp,
+		TxCount:   len(tip.Transactions),
+		PoolSize:  len(bc.TransactionPool),
+	}
+}
+
+// GetBlocks returns a page of blocks, newest first
+func (bc *Blockchain) GetBlocks(q BlockQuery) BlockPage {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	top := len(bc.Chain)
+	if q.Before > 0 && q.Before < top {
+		top = q.Before
+	}
+	bottom := top - pageLimit(q.Limit)
+	if bottom < 0 {
+		bottom = 0
+	}
+	page := BlockPage{Blocks: make([]*Block, 0, top-bottom), NextBefore: bottom}
+	for h := top - 1; h >= bottom; h-- {
+		page.Blocks = append(page.Blocks, bc.Chain[h])
+	}
+	return page
+}
+
+// GetBlockByHeight returns the block at height
+func (bc *Blockchain) GetBlockByHeight(height int) (*Block, bool) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	if height < 0 || height >= len(bc.Chain) {
+		return nil, false
+	}
+	return bc.Chain[height], true
+}
+
+// GetBlockByHash returns the block with the given hash
+func (bc *Blockchain) GetBlockByHash(hash string) (*Block, bool) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	height, ok := bc.blockHeights[hash]
+	if !ok {
+		return nil, false
+	}
+	return bc.Chain[height], true
+}
+
+// GetMempool returns a page of the pool in the order it is mined
+func (bc *Blockchain) GetMempool(offset, limit int) MempoolPage {
+	bc.mu.RLock()
+	ordered := orderByPriority(bc.TransactionPool)
+	bc.mu.RUnlock()
+
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > len(ordered) {
+		offset = len(ordered)
+	}
+	end := offset + pageLimit(limit)
+	if end > len(ordered) {
+		end = len(ordered)
+	}
+	page := MempoolPage{Total: len(ordered), Offset: offset, Transactions: make([]PooledTransaction, 0, end-offset)}
+	for _, tx := range ordered[offset:end] {
+		page.Transactions = append(page.Transactions, PooledTransaction{ID: tx.ID(), Transaction: tx})
+	}
+	return page
+}
+
+// GetAccount returns the confirmed state of address and what is left once the pool is mined
+func (bc *Blockchain) GetAccount(address string) AccountState {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	at := bc.nextBlockTime()
+	bp, _ := bc.basePowerAt(address, at)
+	pendingBP, committed := bc.pendingCosts(address, at)
+	state := AccountState{
+		Address:           address,
+		Balance:           bc.Balances[address],
+		Nonce:             bc.Nonces[address],
+		BasePower:         bp,
+		BasePowerCapacity: bc.basePowerCapacity(address),
+		Staked:            bc.Stakes[address],
+		TokenBalances:     make(map[string]float64),
+		Pending: PendingAccount{
+			Nonce:         bc.pendingNonce(address),
+			Balance:       bc.Balances[address] - committed,
+			BasePower:     pendingBP,
+			TokenBalances: make(map[string]float64),
+		},
+	}
+	state.Pending.Transactions = state.Pending.Nonce - state.Nonce
+	for tokenID, holders := range bc.TokenBalances {
+		if balance, ok := holders[address]; ok {
+			state.TokenBalances[tokenID] = balance
+			state.Pending.TokenBalances[tokenID] = bc.calculatePendingTokenBalance(address, tokenID)
+		}
+	}
+	return state
+}
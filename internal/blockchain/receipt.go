@@ -0,0 +1,33 @@
+package blockchain
+
+// ReceiptStatus is the execution result of a transaction
+type ReceiptStatus string
+
+const (
+	ReceiptSuccess ReceiptStatus = "success"
+	ReceiptFailed  ReceiptStatus = "failed"
+)
+
+// Receipt records how a transaction was executed in a block
+type Receipt struct {
+	TxID          string        // ID of the transaction
+	Status        ReceiptStatus // Success or failure
+	Reason        string        // Failure reason, empty on success
+	FeeCharged    float64       // UNBT charged for BasePower fallback and ExtraPower
+	BasePowerUsed int           // BasePower consumed by the transaction
+	FeePayer      string        // Sponsor charged the fee and BasePower, empty when the sender paid
+	BlockHeight   int           // Index of the block containing the transaction
+	Index         int           // Position of the transaction in the block
+}
+
+// GetReceipt returns the receipt of a transaction included in the chain
+func (bc *Blockchain) GetReceipt(txID string) (Receipt, bool) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	loc, ok := bc.txIndex[txID]
+	if !ok {
+		return Receipt{}, false
+	}
+	return bc.Chain[loc.BlockHeight].Receipts[loc.Index], true
+}
@@ -0,0 +1,160 @@
+package blockchain
+
+import (
+	"unknownberrytrip/internal/logging"
+	"unknownberrytrip/internal/transaction"
+)
+
+// Simulation is what would happen to a transaction sent now
+type Simulation struct {
+	ID       string
+	Accepted bool            // Passes the pool checks
+	Receipt  *Receipt        `json:",omitempty"` // Execution in the next block, nil when not accepted
+	Fee      FeeBreakdown    // Charged for the transaction in the next block
+	Balances []BalanceChange // Balances of the addresses involved, now and after the next block
+	Err      error           `json:"-"` // Why the pool would refuse it, nil when accepted
+}
+
+// FeeBreakdown splits the fee of a transaction into BasePower and UNBT
+type FeeBreakdown struct {
+	Payer              string  // Address charged the fee
+	BasePowerRequired  int     // BasePower covering the base fee
+	BasePowerAvailable int     // BasePower the payer has when the transaction executes
+	BasePowerUsed      int     // BasePower consumed, 0 when the base fee falls back to UNBT
+	BaseFee            float64 // UNBT paid for the base fee when BasePower falls short, else 0
+	ExtraPowerCost     float64 // UNBT paid for the ExtraPower
+	TotalCost          float64 // UNBT paid in total
+}
+
+// BalanceChange is the balance of an address in one asset before and after
+type BalanceChange struct {
+	Address string
+	Asset   string // UNBT, or the token ID
+	Before  float64
+	After   float64
+}
+
+// SimulateTransaction runs the pool checks on tx and executes it in the next
+// block after the pooled transactions mined ahead of it. Execution happens on a
+// scratch copy of the state, so the chain is neither changed nor locked for
+// writing, and nothing is logged. The signature is only checked when
+// verifySignature is set, so costs can be shown before signing.
+func (bc *Blockchain) SimulateTransaction(tx transaction.Transaction, verifySignature bool) Simulation {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	sim := Simulation{ID: tx.ID()}
+	assets := []string{"UNBT"}
+	if tx.IsTokenTransfer {
+		assets = []string{"UNBT", tx.TokenID}
+	}
+	var addresses []string
+	for _, address := range []string{tx.From, tx.To, tx.Payer()} {
+		if address != "" && !containsString(addresses, address) {
+			addresses = append(addresses, address)
+		}
+	}
+	balances := func(chain *Blockchain) []float64 {
+		var values []float64
+		for _, address := range addresses {
+			for _, asset := range assets {
+				if asset == "UNBT" {
+					values = append(values, chain.Balances[address])
+				} else {
+					values = append(values, chain.TokenBalances[asset][address])
+				}
+			}
+		}
+		return values
+	}
+	report := func(before, after []float64) {
+		for i, address := range addresses {
+			for j, asset := range assets {
+				k := i*len(assets) + j
+				sim.Balances = append(sim.Balances, BalanceChange{Address: address, Asset: asset, Before: before[k], After: after[k]})
+			}
+		}
+	}
+	before := balances(bc)
+
+	if err := bc.checkTransaction(tx, verifySignature); err != nil {
+		// Still show what it would cost after the pooled transactions of the payer
+		bp, _ := bc.pendingCosts(tx.Payer(), bc.nextBlockTime())
+		sim.Fee = feeBreakdown(tx, bp)
+		sim.Err = err
+		report(before, before)
+		return sim
+	}
+	sim.Accepted = true
+
+	scratch := bc.scratch()
+	prevBlock := bc.Chain[len(bc.Chain)-1]
+	block := createBlock(nil, prevBlock, "")
+	block.Timestamp = bc.nextBlockTime()
+	scratch.releaseUnbonded(block.Index)
+	scratch.expireDelegations(block)
+	candidates := append(append([]transaction.Transaction(nil), bc.TransactionPool...), tx)
+	for _, pooled := range orderByPriority(candidates) {
+		if pooled.ID() == sim.ID {
+			break
+		}
+		if pooled.Nonce != scratch.Nonces[pooled.From] {
+			continue
+		}
+		if _, ok := scratch.applyTransaction(pooled, block); ok {
+			scratch.Nonces[pooled.From]++
+		}
+	}
+
+	payer := tx.Payer()
+	scratch.updateBasePower(payer, block.Timestamp)
+	sim.Fee = feeBreakdown(tx, scratch.BasePower[payer])
+
+	receipt, _ := scratch.applyTransaction(tx, block)
+	receipt.TxID = sim.ID
+	receipt.BlockHeight = block.Index
+	sim.Receipt = &receipt
+	report(before, balances(scratch))
+	return sim
+}
+
+// scratch returns a chain sharing the blocks, pool and parameters of bc with a
+// copy of its account state, for executing blocks that are thrown away. It logs
+// nothing and has no subscribers; bc.mu must be held.
+func (bc *Blockchain) scratch() *Blockchain {
+	quiet := logging.Discard()
+	s := &Blockchain{
+		Chain:           bc.Chain,
+		TransactionPool: bc.TransactionPool,
+		Params:          bc.Params,
+		events:          newEventBus(),
+		logs:            loggers{chain: quiet, pool: quiet, mining: quiet, audit: quiet},
+	}
+	s.restoreState(bc.snapshotState())
+	return s
+}
+
+// feeBreakdown splits the cost of tx for a payer holding bp BasePower the way
+// txCost charges it
+func feeBreakdown(tx transaction.Transaction, bp int) FeeBreakdown {
+	fee := FeeBreakdown{Payer: tx.Payer(), BasePowerRequired: baseUNBTpower, BasePowerAvailable: bp}
+	if tx.IsTokenTransfer {
+		fee.BasePowerRequired = baseTokenPower
+	}
+	fee.BasePowerUsed, fee.TotalCost = txCost(tx, bp)
+	if tx.ExtraPower > 0 {
+		fee.ExtraPowerCost = float64(tx.ExtraPower) * extraPowerCost
+	}
+	fee.BaseFee = fee.TotalCost - fee.ExtraPowerCost
+	return fee
+}
+
+// containsString reports whether list holds s
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,154 @@
+package blockchain
+
+import (
+	"math"
+	"sort"
+	"unknownberrytrip/internal/transaction"
+)
+
+// Unbonding is staked UNBT on its way back to the spendable balance
+type Unbonding struct {
+	Amount        float64
+	ReleaseHeight int // First block height at which the amount is spendable again
+}
+
+// StakeInfo describes the stake of an address and the BasePower it earns
+type StakeInfo struct {
+	Address   string
+	Staked    float64     // UNBT locked and earning BasePower
+	Unbonding []Unbonding // UNBT unstaked but not yet released, oldest first
+	Capacity  int         // BasePower regenerated per day and the most it can hold, delegations included
+	BasePower int         // BasePower available to the next block after pooled transactions
+}
+
+// checkTxType rejects transactions the chain cannot execute
+func checkTxType(tx transaction.Transaction) error {
+	switch tx.Type {
+	case transaction.TxTransfer:
+		if tx.ExpiryHeight != 0 {
+			return rejectTx(ErrInvalidTransaction, map[string]interface{}{"expiryHeight": tx.ExpiryHeight}, "invalid expiry height %d", tx.ExpiryHeight)
+		}
+		// A negative amount would pull funds from the recipient
+		if !(tx.Amount >= 0) || math.IsInf(tx.Amount, 0) {
+			return rejectTx(ErrInvalidAmount, nil, "transfer amount must be a non-negative number")
+		}
+		return nil
+	case transaction.TxStake, transaction.TxUnstake:
+		if tx.IsTokenTransfer {
+			return rejectTx(ErrInvalidTransaction, nil, "%s transaction cannot move tokens", tx.Type)
+		}
+		if tx.ExpiryHeight != 0 {
+			return rejectTx(ErrInvalidTransaction, map[string]interface{}{"expiryHeight": tx.ExpiryHeight}, "invalid expiry height %d", tx.ExpiryHeight)
+		}
+		if !(tx.Amount > 0) {
+			return rejectTx(ErrInvalidAmount, nil, "%s amount must be positive", tx.Type)
+		}
+		return nil
+	case transaction.TxDelegate, transaction.TxUndelegate:
+		if tx.IsTokenTransfer {
+			return rejectTx(ErrInvalidTransaction, nil, "%s transaction cannot move tokens", tx.Type)
+		}
+		if tx.To == "" || tx.To == tx.From {
+			return rejectTx(ErrInvalidTransaction, nil, "%s needs another address as recipient", tx.Type)
+		}
+		if tx.Type == transaction.TxDelegate && !isWholeBP(tx.Amount) {
+			return rejectTx(ErrInvalidAmount, nil, "delegated BasePower must be a positive whole number")
+		}
+		if tx.Type == transaction.TxUndelegate && tx.Amount != 0 {
+			return rejectTx(ErrInvalidAmount, nil, "undelegate amount must be 0")
+		}
+		if tx.ExpiryHeight < 0 || (tx.ExpiryHeight != 0 && tx.Type != transaction.TxDelegate) {
+			return rejectTx(ErrInvalidTransaction, map[string]interface{}{"expiryHeight": tx.ExpiryHeight}, "invalid expiry height %d", tx.ExpiryHeight)
+		}
+		return nil
+	default:
+		return rejectTx(ErrInvalidTransaction, map[string]interface{}{"type": tx.Type}, "unknown transaction type %q", tx.Type)
+	}
+}
+
+// spendsAmount reports whether a transaction takes Amount out of the UNBT balance
+func spendsAmount(tx transaction.Transaction) bool {
+	return !tx.IsTokenTransfer && (tx.Type == transaction.TxTransfer || tx.Type == transaction.TxStake)
+}
+
+// releaseUnbonded moves unbonding UNBT that matured at height back to balances,
+// returning the released amounts sorted by address
+func (bc *Blockchain) releaseUnbonded(height int) []Payout {
+	addresses := make([]string, 0, len(bc.Unbonding))
+	for address := range bc.Unbonding {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+
+	var released []Payout
+	for _, address := range addresses {
+		amount := 0.0
+		pending := bc.Unbonding[address][:0]
+		for _, u := range bc.Unbonding[address] {
+			if u.ReleaseHeight <= height {
+				amount += u.Amount
+			} else {
+				pending = append(pending, u)
+			}
+		}
+		if amount == 0 {
+			continue
+		}
+		if len(pending) == 0 {
+			delete(bc.Unbonding, address)
+		} else {
+			bc.Unbonding[address] = pending
+		}
+		bc.Balances[address] += amount
+		released = append(released, Payout{Address: address, Amount: amount})
+		bc.logs.chain.Debug("Unbonded UNBT released", "address", address, "amount", amount)
+	}
+	return released
+}
+
+// stake locks amount of the balance of address. BasePower is regenerated at the
+// block timestamp first, so the new capacity only applies from now on.
+func (bc *Blockchain) stake(address string, amount float64, at int64) {
+	bc.updateBasePower(address, at)
+	bc.Balances[address] -= amount
+	bc.Stakes[address] += amount
+}
+
+// unstake starts unbonding amount of the stake of address, released at height plus
+// Params.UnbondingPeriod. BasePower is regenerated at the block timestamp first.
+func (bc *Blockchain) unstake(address string, amount float64, height int, at int64) {
+	bc.updateBasePower(address, at)
+	bc.Stakes[address] -= amount
+	if bc.Stakes[address] <= 0 {
+		delete(bc.Stakes, address)
+	}
+	bc.Unbonding[address] = append(bc.Unbonding[address], Unbonding{
+		Amount:        amount,
+		ReleaseHeight: height + bc.Params.UnbondingPeriod,
+	})
+}
+
+// pendingUnstake returns the stake of address already being unstaked by pooled transactions
+func (bc *Blockchain) pendingUnstake(address string) float64 {
+	pending := 0.0
+	for _, tx := range bc.pooled(address).sent {
+		if tx.Type == transaction.TxUnstake {
+			pending += tx.Amount
+		}
+	}
+	return pending
+}
+
+// GetStake returns the stake, unbonding UNBT and BasePower capacity of address
+func (bc *Blockchain) GetStake(address string) StakeInfo {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	bp, _ := bc.pendingCosts(address, bc.nextBlockTime())
+	return StakeInfo{
+		Address:   address,
+		Staked:    bc.Stakes[address],
+		Unbonding: append([]Unbonding(nil), bc.Unbonding[address]...),
+		Capacity:  bc.basePowerCapacity(address),
+		BasePower: bp,
+	}
+}
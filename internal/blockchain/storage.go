@@ -0,0 +1,163 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"unknownberrytrip/internal/transaction"
+)
+
+// stateSnapshot is a copy of the account state, used to roll back a block
+type stateSnapshot struct {
+	Balances      map[string]float64
+	TokenBalances map[string]map[string]float64
+	Nonces        map[string]int
+	BasePower     map[string]int
+	LastBPUpdate  map[string]int64
+	Stakes        map[string]float64
+	Unbonding     map[string][]Unbonding
+	Delegations   map[string]map[string]Delegation
+	Minted        float64
+	Burned        float64
+}
+
+// snapshotState copies the account state
+func (bc *Blockchain) snapshotState() stateSnapshot {
+	s := stateSnapshot{
+		Balances:     make(map[string]float64, len(bc.Balances)),
+		Nonces:       make(map[string]int, len(bc.Nonces)),
+		BasePower:    make(map[string]int, len(bc.BasePower)),
+		LastBPUpdate: make(map[string]int64, len(bc.LastBPUpdate)),
+		Stakes:       make(map[string]float64, len(bc.Stakes)),
+		Unbonding:    make(map[string][]Unbonding, len(bc.Unbonding)),
+		Delegations:  make(map[string]map[string]Delegation, len(bc.Delegations)),
+		Minted:       bc.Minted,
+		Burned:       bc.Burned,
+	}
+	for k, v := range bc.Balances {
+		s.Balances[k] = v
+	}
+	s.TokenBalances = make(map[string]map[string]float64, len(bc.TokenBalances))
+	for tokenID, holders := range bc.TokenBalances {
+		copied := make(map[string]float64, len(holders))
+		for k, v := range holders {
+			copied[k] = v
+		}
+		s.TokenBalances[tokenID] = copied
+	}
+	for k, v := range bc.Nonces {
+		s.Nonces[k] = v
+	}
+	for k, v := range bc.BasePower {
+		s.BasePower[k] = v
+	}
+	for k, v := range bc.LastBPUpdate {
+		s.LastBPUpdate[k] = v
+	}
+	for k, v := range bc.Stakes {
+		s.Stakes[k] = v
+	}
+	for k, v := range bc.Unbonding {
+		s.Unbonding[k] = append([]Unbonding(nil), v...)
+	}
+	for delegator, delegatees := range bc.Delegations {
+		copied := make(map[string]Delegation, len(delegatees))
+		for k, v := range delegatees {
+			copied[k] = v
+		}
+		s.Delegations[delegator] = copied
+	}
+	return s
+}
+
+// restoreState replaces the account state with a snapshot
+func (bc *Blockchain) restoreState(s stateSnapshot) {
+	bc.Balances = s.Balances
+	bc.TokenBalances = s.TokenBalances
+	bc.Nonces = s.Nonces
+	bc.BasePower = s.BasePower
+	bc.LastBPUpdate = s.LastBPUpdate
+	bc.Stakes = s.Stakes
+	bc.Unbonding = s.Unbonding
+	bc.Delegations = s.Delegations
+	bc.Minted = s.Minted
+	bc.Burned = s.Burned
+}
+
+// stateFile is the on-disk form of a blockchain
+type stateFile struct {
+	Params          ChainParams
+	Chain           []*Block
+	State           stateSnapshot
+	TransactionPool []transaction.Transaction
+}
+
+// SaveToFile writes the chain, account state and transaction pool to path.
+// The file is replaced atomically, so a crash never leaves a partial state.
+func (bc *Blockchain) SaveToFile(path string) error {
+	bc.mu.RLock()
+	blocks, pooled := len(bc.Chain), len(bc.TransactionPool)
+	data, err := json.Marshal(stateFile{
+		Params:          bc.Params,
+		Chain:           bc.Chain,
+		State:           bc.snapshotState(),
+		TransactionPool: bc.TransactionPool,
+	})
+	bc.mu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("encode state: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("write state: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("replace state: %w", err)
+	}
+	bc.logs.chain.Info("State saved", "blocks", blocks, "pooled", pooled, "path", path)
+	return nil
+}
+
+// LoadBlockchain reads a blockchain written by SaveToFile and rebuilds its indexes
+func LoadBlockchain(path string) (*Blockchain, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read state: %w", err)
+	}
+	var file stateFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("decode state: %w", err)
+	}
+	if len(file.Chain) == 0 {
+		return nil, fmt.Errorf("state %s has no genesis block", path)
+	}
+
+	bc := &Blockchain{
+		Chain:           file.Chain,
+		TransactionPool: file.TransactionPool,
+		Params:          file.Params,
+	}
+	bc.init()
+	if file.State.TokenBalances == nil {
+		file.State.TokenBalances = make(map[string]map[string]float64)
+	}
+	if file.State.Stakes == nil {
+		file.State.Stakes = make(map[string]float64)
+	}
+	if file.State.Unbonding == nil {
+		file.State.Unbonding = make(map[string][]Unbonding)
+	}
+	if file.State.Delegations == nil {
+		file.State.Delegations = make(map[string]map[string]Delegation)
+	}
+	if file.State.Balances == nil || file.State.Nonces == nil || file.State.BasePower == nil || file.State.LastBPUpdate == nil {
+		return nil, fmt.Errorf("state %s has no account state", path)
+	}
+	bc.restoreState(file.State)
+	for _, block := range bc.Chain[1:] {
+		bc.indexBlock(block)
+	}
+	bc.logs.chain.Info("State loaded", "blocks", len(bc.Chain), "pooled", len(bc.TransactionPool), "path", path)
+	return bc, nil
+}
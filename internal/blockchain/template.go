@@ -0,0 +1,123 @@
+package blockchain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"unknownberrytrip/internal/transaction"
+)
+
+// maxTemplates bounds the templates kept for the current tip
+const maxTemplates = 64
+
+// BlockTemplate is work handed to an external miner. A solution is a nonce such
+// that SHA-256 of HeaderPrefix (hex-decoded) followed by the nonce as 8 big-endian
+// bytes starts with Difficulty zero hex digits.
+type BlockTemplate struct {
+	ID           string // Identifier to submit the solution against
+	Index        int
+	Timestamp    int64
+	PrevHash     string
+	Miner        string
+	Coinbase     []Payout // Split of Reward, empty to pay it all to Miner
+	Reward       float64  // Block reward plus the miner's share of fees
+	TxRoot       string
+	Transactions []transaction.Transaction
+	Difficulty   int    // Leading zero hex digits required in the block hash
+	HeaderPrefix string // Hex-encoded header without the nonce
+}
+
+// GetBlockTemplate builds a block from the pool for miner and returns it as work.
+// The coinbase pays the block reward plus the miner's share of fees; when
+// splitReward is given it divides that total between addresses, which pools use
+// to pay their miners. Otherwise everything goes to miner, and the template is
+// built once per tip and miner: transactions pooled since join at the next tip.
+// Templates are valid until the tip changes.
+func (bc *Blockchain) GetBlockTemplate(miner string, splitReward func(total float64) []Payout) *BlockTemplate {
+	if splitReward == nil {
+		bc.mu.RLock()
+		cached, ok := bc.templateCache[miner]
+		if ok && bc.templates[cached.ID] == nil {
+			ok = false // Evicted by newer templates
+		}
+		bc.mu.RUnlock()
+		if ok {
+			tmpl := *cached
+			return &tmpl
+		}
+	}
+
+	block, _, fees, _ := bc.buildBlock(bc.PendingTransactions(), miner)
+	bc.mu.RLock()
+	value := bc.splitFees(fees).Miner
+	if len(block.Transactions) > 0 {
+		value += bc.blockReward(block.Index)
+	}
+	bc.mu.RUnlock()
+	if value > 0 && splitReward != nil {
+		block.Coinbase = splitReward(value)
+	}
+	prefix := block.headerPrefix()
+	sum := sha256.Sum256(prefix)
+	tmpl := &BlockTemplate{
+		ID:           hex.EncodeToString(sum[:]),
+		Index:        block.Index,
+		Timestamp:    block.Timestamp,
+		PrevHash:     block.PrevHash,
+		Miner:        block.Miner,
+		Coinbase:     block.Coinbase,
+		Reward:       value,
+		TxRoot:       block.TxRoot(),
+		Transactions: block.Transactions,
+		Difficulty:   difficulty,
+		HeaderPrefix: hex.EncodeToString(prefix),
+	}
+
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	if block.PrevHash != bc.Chain[len(bc.Chain)-1].Hash {
+		// The tip moved while building; hand out the work anyway, submission will be rejected as stale
+		return tmpl
+	}
+	if _, ok := bc.templates[tmpl.ID]; !ok {
+		if len(bc.templateOrder) >= maxTemplates {
+			delete(bc.templates, bc.templateOrder[0])
+			bc.templateOrder = bc.templateOrder[1:]
+		}
+		bc.templates[tmpl.ID] = block
+		bc.templateOrder = append(bc.templateOrder, tmpl.ID)
+	}
+	if splitReward == nil && len(bc.templateCache) < maxTemplates {
+		cached := *tmpl
+		bc.templateCache[miner] = &cached
+	}
+	bc.logs.mining.Debug("Template issued", "template", tmpl.ID, "height", tmpl.Index, "txs", len(tmpl.Transactions))
+	return tmpl
+}
+
+// SubmitBlock completes a template with a solved nonce, then validates and imports
+// the block
+func (bc *Blockchain) SubmitBlock(templateID string, nonce int) (*Block, error) {
+	bc.mu.RLock()
+	tmpl, ok := bc.templates[templateID]
+	bc.mu.RUnlock()
+	if !ok {
+		return nil, ErrUnknownTemplate
+	}
+
+	block := *tmpl
+	block.Nonce = nonce
+	block.Hash = block.CalculateHash()
+	if err := bc.importBlock(&block, nil); err != nil {
+		bc.logs.mining.Warn("Template submission rejected", "template", templateID, "reason", err)
+		return nil, err
+	}
+	bc.logs.mining.Info("Template block imported", "template", templateID, "height", block.Index)
+	return &block, nil
+}
+
+// clearTemplates forgets the templates built on the previous tip
+func (bc *Blockchain) clearTemplates() {
+	bc.templates = make(map[string]*Block)
+	bc.templateOrder = nil
+	bc.templateCache = make(map[string]*BlockTemplate)
+}
@@ -0,0 +1,24 @@
+package blockchain
+
+// creditTokens adds amount of a token to address
+func (bc *Blockchain) creditTokens(tokenID, address string, amount float64) {
+	holders, ok := bc.TokenBalances[tokenID]
+	if !ok {
+		holders = make(map[string]float64)
+		bc.TokenBalances[tokenID] = holders
+	}
+	holders[address] += amount
+}
+
+// transferTokens moves amount of a token between addresses; the caller checks the balance
+func (bc *Blockchain) transferTokens(tokenID, from, to string, amount float64) {
+	bc.creditTokens(tokenID, from, -amount)
+	bc.creditTokens(tokenID, to, amount)
+}
+
+// GetTokenBalance returns the token balance of an address
+func (bc *Blockchain) GetTokenBalance(tokenID, address string) float64 {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.TokenBalances[tokenID][address]
+}
@@ -0,0 +1,85 @@
+package blockchain
+
+import "unknownberrytrip/internal/transaction"
+
+// TxLocation is the position of a transaction in the chain
+type TxLocation struct {
+	BlockHeight int // Index of the block
+	Index       int // Position in the block
+}
+
+// poolAccount holds the pooled transactions involving an address, so pool
+// admission checks an address without scanning or ordering the whole pool
+type poolAccount struct {
+	sent []transaction.Transaction // Sent by the address, in nonce order
+	paid []transaction.Transaction // Whose fee the address pays, in pool order
+}
+
+// indexPool rebuilds the indexes of the pooled transactions
+func (bc *Blockchain) indexPool() {
+	bc.poolIndex = make(map[string]int, len(bc.TransactionPool))
+	for i := range bc.TransactionPool {
+		bc.poolIndex[bc.TransactionPool[i].ID()] = i
+	}
+	bc.indexPoolAccounts()
+}
+
+// indexPoolAccounts rebuilds the pooled transactions by address
+func (bc *Blockchain) indexPoolAccounts() {
+	bc.poolAccounts = make(map[string]*poolAccount)
+	for _, tx := range bc.TransactionPool {
+		bc.addPoolAccounts(tx)
+	}
+}
+
+// addPoolAccounts records a pooled transaction under its sender and fee payer
+func (bc *Blockchain) addPoolAccounts(tx transaction.Transaction) {
+	for _, address := range []string{tx.From, tx.Payer()} {
+		if bc.poolAccounts[address] == nil {
+			bc.poolAccounts[address] = &poolAccount{}
+		}
+	}
+	sender := bc.poolAccounts[tx.From]
+	sender.sent = append(sender.sent, tx)
+	payer := bc.poolAccounts[tx.Payer()]
+	payer.paid = append(payer.paid, tx)
+}
+
+// pooled returns the pooled transactions involving address
+func (bc *Blockchain) pooled(address string) poolAccount {
+	if acct := bc.poolAccounts[address]; acct != nil {
+		return *acct
+	}
+	return poolAccount{}
+}
+
+// indexBlock records the block and its transactions in the indexes, stamps their
+// receipts with the transaction IDs and extends the address history
+func (bc *Blockchain) indexBlock(block *Block) {
+	bc.blockHeights[block.Hash] = block.Index
+	for i := range block.Transactions {
+		id := block.Transactions[i].ID()
+		bc.txIndex[id] = TxLocation{BlockHeight: block.Index, Index: i}
+		if i < len(block.Receipts) {
+			block.Receipts[i].TxID = id
+		}
+	}
+	if block.Index == bc.historyHeight+1 {
+		bc.indexHistory(block)
+	}
+}
+
+// GetTransaction looks up an included transaction by ID and returns it with its
+// location and number of confirmations (1 when it is in the tip block)
+func (bc *Blockchain) GetTransaction(txID string) (transaction.Transaction, TxLocation, int, bool) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	loc, ok := bc.txIndex[txID]
+	if !ok {
+		return transaction.Transaction{}, TxLocation{}, 0, false
+	}
+	tx := bc.Chain[loc.BlockHeight].Transactions[loc.Index]
+	confirmations := len(bc.Chain) - loc.BlockHeight
+	return tx, loc, confirmations, true
+}
@@ -0,0 +1,100 @@
+package blockchain
+
+import "unknownberrytrip/internal/transaction"
+
+// maxDroppedTxs bounds how many dropped transactions are remembered
+const maxDroppedTxs = 10000
+
+// TxState is where a transaction is in its lifecycle
+type TxState string
+
+const (
+	TxPending  TxState = "pending"  // In the pool, within a block's worth of the front
+	TxQueued   TxState = "queued"   // In the pool behind at least a full block of others
+	TxIncluded TxState = "included" // In a block and executed
+	TxFailed   TxState = "failed"   // In a block, but execution failed; only the fee was charged
+	TxDropped  TxState = "dropped"  // Removed from the pool without being included
+)
+
+// TxStatus reports the state of a transaction looked up by ID
+type TxStatus struct {
+	ID            string
+	Status        TxState
+	Transaction   transaction.Transaction
+	PoolPosition  int      `json:",omitempty"` // 1-based position in mining order while pooled
+	BlockHeight   int      `json:",omitempty"`
+	BlockHash     string   `json:",omitempty"`
+	Index         int      `json:",omitempty"` // Position in the block
+	Confirmations int      `json:",omitempty"` // 1 when the block is the tip
+	Receipt       *Receipt `json:",omitempty"`
+	Reason        string   `json:",omitempty"` // Why it was dropped
+	DroppedHeight int      `json:",omitempty"` // Tip height when it was dropped
+}
+
+// droppedTx is a transaction removed from the pool unmined
+type droppedTx struct {
+	tx     transaction.Transaction
+	reason string
+	height int
+}
+
+// recordDropped remembers a transaction removed from the pool, forgetting the
+// oldest once maxDroppedTxs are kept
+func (bc *Blockchain) recordDropped(tx transaction.Transaction, reason string) {
+	id := tx.ID()
+	if _, ok := bc.dropped[id]; !ok {
+		bc.droppedOrder = append(bc.droppedOrder, id)
+	}
+	bc.dropped[id] = droppedTx{tx: tx, reason: reason, height: len(bc.Chain) - 1}
+	for len(bc.droppedOrder) > maxDroppedTxs {
+		delete(bc.dropped, bc.droppedOrder[0])
+		bc.droppedOrder = bc.droppedOrder[1:]
+	}
+}
+
+// TransactionStatus looks a transaction up in the chain, the pool and the
+// transactions dropped since the node started, in that order
+func (bc *Blockchain) TransactionStatus(txID string) (TxStatus, bool) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	if loc, ok := bc.txIndex[txID]; ok {
+		block := bc.Chain[loc.BlockHeight]
+		status := TxStatus{
+			ID:            txID,
+			Status:        TxIncluded,
+			Transaction:   block.Transactions[loc.Index],
+			BlockHeight:   loc.BlockHeight,
+			BlockHash:     block.Hash,
+			Index:         loc.Index,
+			Confirmations: len(bc.Chain) - loc.BlockHeight,
+		}
+		if loc.Index < len(block.Receipts) {
+			receipt := block.Receipts[loc.Index]
+			status.Receipt = &receipt
+			if receipt.Status == ReceiptFailed {
+				status.Status = TxFailed
+			}
+		}
+		return status, true
+	}
+	if slot, ok := bc.poolIndex[txID]; ok {
+		// Positions shift with every admission, so they are ordered on demand
+		position := 0
+		for i, index := range priorityOrder(bc.TransactionPool) {
+			if index == slot {
+				position = i
+				break
+			}
+		}
+		status := TxStatus{ID: txID, Status: TxPending, Transaction: bc.TransactionPool[slot], PoolPosition: position + 1}
+		if max := bc.Params.MaxBlockTxs; max > 0 && position >= max {
+			status.Status = TxQueued
+		}
+		return status, true
+	}
+	if d, ok := bc.dropped[txID]; ok {
+		return TxStatus{ID: txID, Status: TxDropped, Transaction: d.tx, Reason: d.reason, DroppedHeight: d.height}, true
+	}
+	return TxStatus{}, false
+}
@@ -0,0 +1,224 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"unknownberrytrip/internal/api"
+	"unknownberrytrip/internal/blockchain"
+	"unknownberrytrip/internal/transaction"
+)
+
+// ErrNotFound is returned when the requested block, transaction or account does not exist
+var ErrNotFound = errors.New("not found")
+
+// APIError is a failed call as reported by the node. It matches ErrNotFound
+// under errors.Is when the node answered 404.
+type APIError struct {
+	Method, Path string
+	Status       int    // HTTP status code
+	Code         string // Stable code such as NONCE_TOO_LOW, empty if the body had none
+	Message      string
+	Details      map[string]interface{} // Values behind the failure, like the expected nonce
+}
+
+func (e *APIError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("%s %s: %d %s: %s", e.Method, e.Path, e.Status, http.StatusText(e.Status), e.Message)
+	}
+	return fmt.Sprintf("%s %s: %s: %s", e.Method, e.Path, e.Code, e.Message)
+}
+
+func (e *APIError) Is(target error) bool {
+	return target == ErrNotFound && e.Status == http.StatusNotFound
+}
+
+// Client talks to the HTTP API of a node
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// New creates a client for the node API at baseURL, e.g. "http://localhost:8080"
+func New(baseURL string) *Client {
+	return &Client{baseURL: strings.TrimRight(baseURL, "/"), httpClient: http.DefaultClient}
+}
+
+// SendTransaction submits a signed transaction to the node pool and returns its
+// ID, which Transaction reports the status of
+func (c *Client) SendTransaction(ctx context.Context, tx *transaction.Transaction) (string, error) {
+	body, err := json.Marshal(tx)
+	if err != nil {
+		return "", fmt.Errorf("encode transaction: %w", err)
+	}
+	var result api.SendTransactionResult
+	if err := c.do(ctx, http.MethodPost, "/sendTransaction", nil, body, &result); err != nil {
+		return "", err
+	}
+	return result.ID, nil
+}
+
+// SimulateTransaction asks the node what sending tx would do without sending it.
+// With unsigned set the signature is not checked, so costs can be shown before signing.
+func (c *Client) SimulateTransaction(ctx context.Context, tx *transaction.Transaction, unsigned bool) (*api.SimulateResult, error) {
+	body, err := json.Marshal(tx)
+	if err != nil {
+		return nil, fmt.Errorf("encode transaction: %w", err)
+	}
+	var query url.Values
+	if unsigned {
+		query = url.Values{"unsigned": {"true"}}
+	}
+	var result api.SimulateResult
+	if err := c.do(ctx, http.MethodPost, "/simulateTransaction", query, body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// EstimateFee asks the node how much ExtraPower a transaction needs to be included
+// within req.Blocks blocks with probability req.Confidence
+func (c *Client) EstimateFee(ctx context.Context, req blockchain.FeeEstimateRequest) (*blockchain.FeeEstimate, error) {
+	q := url.Values{}
+	if req.Blocks > 0 {
+		q.Set("blocks", strconv.Itoa(req.Blocks))
+	}
+	if req.Confidence > 0 {
+		q.Set("confidence", strconv.FormatFloat(req.Confidence, 'g', -1, 64))
+	}
+	if req.From != "" {
+		q.Set("from", req.From)
+	}
+	if req.IsTokenTransfer {
+		q.Set("token", "true")
+	}
+	var est blockchain.FeeEstimate
+	if err := c.do(ctx, http.MethodGet, "/estimateFee", q, nil, &est); err != nil {
+		return nil, err
+	}
+	return &est, nil
+}
+
+// Head returns a summary of the tip block
+func (c *Client) Head(ctx context.Context) (*blockchain.ChainHead, error) {
+	var head blockchain.ChainHead
+	if err := c.do(ctx, http.MethodGet, "/chain/head", nil, nil, &head); err != nil {
+		return nil, err
+	}
+	return &head, nil
+}
+
+// Blocks returns a page of blocks, newest first
+func (c *Client) Blocks(ctx context.Context, q blockchain.BlockQuery) (*blockchain.BlockPage, error) {
+	query := url.Values{}
+	if q.Before > 0 {
+		query.Set("before", strconv.Itoa(q.Before))
+	}
+	if q.Limit > 0 {
+		query.Set("limit", strconv.Itoa(q.Limit))
+	}
+	var page blockchain.BlockPage
+	if err := c.do(ctx, http.MethodGet, "/blocks", query, nil, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// BlockByHeight returns the block at height
+func (c *Client) BlockByHeight(ctx context.Context, height int) (*blockchain.Block, error) {
+	return c.block(ctx, strconv.Itoa(height))
+}
+
+// BlockByHash returns the block with the given hash
+func (c *Client) BlockByHash(ctx context.Context, hash string) (*blockchain.Block, error) {
+	return c.block(ctx, url.PathEscape(hash))
+}
+
+func (c *Client) block(ctx context.Context, ref string) (*blockchain.Block, error) {
+	var block blockchain.Block
+	if err := c.do(ctx, http.MethodGet, "/blocks/"+ref, nil, nil, &block); err != nil {
+		return nil, err
+	}
+	return &block, nil
+}
+
+// Transaction reports whether a transaction is pending, queued, included, failed
+// or dropped
+func (c *Client) Transaction(ctx context.Context, id string) (*blockchain.TxStatus, error) {
+	var status blockchain.TxStatus
+	if err := c.do(ctx, http.MethodGet, "/txs/"+url.PathEscape(id), nil, nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Account returns the confirmed and pending state of address
+func (c *Client) Account(ctx context.Context, address string) (*blockchain.AccountState, error) {
+	var state blockchain.AccountState
+	if err := c.do(ctx, http.MethodGet, "/accounts/"+url.PathEscape(address), nil, nil, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// Mempool returns a page of the pool in mining order
+func (c *Client) Mempool(ctx context.Context, offset, limit int) (*blockchain.MempoolPage, error) {
+	query := url.Values{}
+	if offset > 0 {
+		query.Set("offset", strconv.Itoa(offset))
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	var page blockchain.MempoolPage
+	if err := c.do(ctx, http.MethodGet, "/mempool", query, nil, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// do sends a request and decodes a JSON response into out when it is not nil
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body []byte, out interface{}) error {
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		apiErr := &APIError{Method: method, Path: path, Status: resp.StatusCode, Message: strings.TrimSpace(string(msg))}
+		var envelope api.ErrorResponse
+		if json.Unmarshal(msg, &envelope) == nil && envelope.Error.Code != "" {
+			apiErr.Code = envelope.Error.Code
+			apiErr.Message = envelope.Error.Message
+			apiErr.Details = envelope.Error.Details
+		}
+		return apiErr
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode %s response: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"unknownberrytrip/internal/api"
+	"unknownberrytrip/internal/blockchain"
+	"unknownberrytrip/internal/transaction"
+	"unknownberrytrip/internal/wallet"
+)
+
+func TestEstimateFeeAndSendTransaction(t *testing.T) {
+	senderWallet := wallet.NewWallet()
+	params := blockchain.DefaultChainParams()
+	params.GenesisAlloc[senderWallet.Address] = 10.0
+	bc := blockchain.NewBlockchainWithParams(params)
+	srv := httptest.NewServer(api.NewServer(bc, "").Handler())
+	defer srv.Close()
+	c := New(srv.URL)
+	ctx := context.Background()
+
+	est, err := c.EstimateFee(ctx, blockchain.FeeEstimateRequest{Blocks: 3, Confidence: 0.95, From: senderWallet.Address})
+	if err != nil {
+		t.Fatalf("EstimateFee failed: %v", err)
+	}
+	if est.Blocks != 3 || est.Confidence != 0.95 || est.ExtraPower != 0 || est.BasePowerAvailable == 0 {
+		t.Errorf("Unexpected estimate for an empty chain: %+v", est)
+	}
+
+	tx := senderWallet.CreateTransaction("receiver", 1.0, 0)
+	tx.ExtraPower = est.ExtraPower
+	tx.Signature = ""
+	sim, err := c.SimulateTransaction(ctx, tx, true)
+	if err != nil || !sim.Accepted || sim.Error != nil || sim.Fee.TotalCost != est.TotalCost {
+		t.Fatalf("Expected the unsigned transaction to cost %f, got %+v, err %v", est.TotalCost, sim, err)
+	}
+	if sim, err = c.SimulateTransaction(ctx, tx, false); err != nil || sim.Error == nil || sim.Error.Code != "INVALID_SIGNATURE" {
+		t.Errorf("Expected INVALID_SIGNATURE when the signature is checked, got %+v, err %v", sim, err)
+	}
+	tx.Signature = senderWallet.SignTx(tx)
+	id, err := c.SendTransaction(ctx, tx)
+	if err != nil || id != tx.ID() {
+		t.Fatalf("Expected SendTransaction to return %s, got %q, err %v", tx.ID(), id, err)
+	}
+	_, err = c.SendTransaction(ctx, tx)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != "NONCE_TOO_LOW" || apiErr.Details["expected"] != 1.0 {
+		t.Errorf("Expected resending the same nonce to fail with NONCE_TOO_LOW, got %v", err)
+	}
+}
+
+func TestReadEndpoints(t *testing.T) {
+	senderWallet := wallet.NewWallet()
+	params := blockchain.DefaultChainParams()
+	params.GenesisAlloc[senderWallet.Address] = 10.0
+	params.GenesisTokens = map[string]map[string]float64{"BERRY_TOKEN": {senderWallet.Address: 7.0}}
+	bc := blockchain.NewBlockchainWithParams(params)
+	srv := httptest.NewServer(api.NewServer(bc, "").Handler())
+	defer srv.Close()
+	c := New(srv.URL)
+	ctx := context.Background()
+
+	included := senderWallet.CreateTransaction("receiver", 1.0, 0)
+	bc.AddBlock([]transaction.Transaction{*included}, "miner")
+	pending := senderWallet.CreateTransaction("receiver", 2.0, 1)
+	if _, err := c.SendTransaction(ctx, pending); err != nil {
+		t.Fatalf("SendTransaction failed: %v", err)
+	}
+
+	head, err := c.Head(ctx)
+	if err != nil || head.Height != 1 || head.PoolSize != 1 {
+		t.Fatalf("Unexpected head %+v, err %v", head, err)
+	}
+	byHash, err := c.BlockByHash(ctx, head.Hash)
+	if err != nil || byHash.Index != 1 {
+		t.Fatalf("Expected block 1 by hash, got %+v, err %v", byHash, err)
+	}
+	if _, err := c.BlockByHeight(ctx, 5); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a missing block, got %v", err)
+	}
+	page, err := c.Blocks(ctx, blockchain.BlockQuery{Limit: 1})
+	if err != nil || len(page.Blocks) != 1 || page.Blocks[0].Index != 1 || page.NextBefore != 1 {
+		t.Fatalf("Unexpected first page %+v, err %v", page, err)
+	}
+	page, err = c.Blocks(ctx, blockchain.BlockQuery{Before: page.NextBefore, Limit: 1})
+	if err != nil || len(page.Blocks) != 1 || page.Blocks[0].Index != 0 || page.NextBefore != 0 {
+		t.Fatalf("Unexpected last page %+v, err %v", page, err)
+	}
+
+	got, err := c.Transaction(ctx, included.ID())
+	if err != nil || got.Status != "included" || got.BlockHeight != 1 || got.Receipt == nil {
+		t.Errorf("Unexpected included tx %+v, err %v", got, err)
+	}
+	got, err = c.Transaction(ctx, pending.ID())
+	if err != nil || got.Status != "pending" {
+		t.Errorf("Unexpected pending tx %+v, err %v", got, err)
+	}
+
+	account, err := c.Account(ctx, senderWallet.Address)
+	if err != nil {
+		t.Fatalf("Account failed: %v", err)
+	}
+	if account.Balance != 9.0 || account.Nonce != 1 || account.TokenBalances["BERRY_TOKEN"] != 7.0 {
+		t.Errorf("Unexpected confirmed state %+v", account)
+	}
+	if account.Pending.Nonce != 2 || account.Pending.Transactions != 1 || account.Pending.Balance != 7.0 {
+		t.Errorf("Unexpected pending state %+v", account.Pending)
+	}
+
+	mempool, err := c.Mempool(ctx, 0, 10)
+	if err != nil || mempool.Total != 1 || mempool.Transactions[0].ID != pending.ID() {
+		t.Errorf("Unexpected mempool %+v, err %v", mempool, err)
+	}
+}
@@ -0,0 +1,369 @@
+// Package logging is a leveled, structured logger. Loggers derived from the same
+// root share its output, format and level configuration, which can be changed
+// per component at runtime.
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the severity of a log entry
+type Level int
+
+const (
+	LevelDebug Level = iota - 1
+	LevelInfo
+	LevelWarn
+	LevelError
+	LevelOff // Disables a logger; not a level of entries
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	case LevelOff:
+		return "off"
+	}
+	return "level(" + strconv.Itoa(int(l)) + ")"
+}
+
+// MarshalText encodes the level by name
+func (l Level) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+// UnmarshalText decodes a level name
+func (l *Level) UnmarshalText(text []byte) error {
+	level, err := ParseLevel(string(text))
+	if err != nil {
+		return err
+	}
+	*l = level
+	return nil
+}
+
+// ParseLevel parses debug, info, warn, error or off
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return LevelDebug, nil
+	case "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	case "off", "none":
+		return LevelOff, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q", s)
+}
+
+// Format selects how entries are written
+type Format int
+
+const (
+	FormatText Format = iota // time LEVEL [component] message key=value...
+	FormatJSON               // One JSON object per line
+)
+
+// ParseFormat parses text or json
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "text", "":
+		return FormatText, nil
+	case "json":
+		return FormatJSON, nil
+	}
+	return 0, fmt.Errorf("unknown log format %q", s)
+}
+
+// Options configure a root logger
+type Options struct {
+	Level  Level            // Level of components without their own
+	Levels map[string]Level // Level by component
+	Format Format
+}
+
+// config is shared by a root logger and everything derived from it
+type config struct {
+	mu     sync.RWMutex
+	out    io.Writer
+	format Format
+	level  Level
+	levels map[string]Level
+	now    func() time.Time
+}
+
+// Logger writes entries tagged with a component and key/value attributes.
+// A nil *Logger discards everything.
+type Logger struct {
+	cfg       *config
+	component string
+	attrs     []interface{}
+}
+
+// New creates a root logger writing to out
+func New(out io.Writer, opts Options) *Logger {
+	levels := make(map[string]Level, len(opts.Levels))
+	for component, level := range opts.Levels {
+		levels[component] = level
+	}
+	return &Logger{cfg: &config{out: out, format: opts.Format, level: opts.Level, levels: levels, now: time.Now}}
+}
+
+var defaultLogger = New(os.Stdout, Options{Level: LevelInfo})
+
+// Default returns the process-wide logger used by components not given one. It
+// writes text to stdout at info level.
+func Default() *Logger {
+	return defaultLogger
+}
+
+// Discard returns a logger that writes nothing
+func Discard() *Logger {
+	return New(io.Discard, Options{Level: LevelOff})
+}
+
+// Component returns a logger for the named component, configured by its level
+func (l *Logger) Component(name string) *Logger {
+	if l == nil {
+		return nil
+	}
+	return &Logger{cfg: l.cfg, component: name, attrs: l.attrs}
+}
+
+// With returns a logger adding key/value pairs to every entry
+func (l *Logger) With(keyvals ...interface{}) *Logger {
+	if l == nil {
+		return nil
+	}
+	attrs := make([]interface{}, 0, len(l.attrs)+len(keyvals))
+	attrs = append(append(attrs, l.attrs...), keyvals...)
+	return &Logger{cfg: l.cfg, component: l.component, attrs: attrs}
+}
+
+// SetLevel sets the level of a component, or the default level when component is
+// empty. It applies to every logger sharing the root of l.
+func (l *Logger) SetLevel(component string, level Level) {
+	l.cfg.mu.Lock()
+	defer l.cfg.mu.Unlock()
+	if component == "" {
+		l.cfg.level = level
+	} else {
+		l.cfg.levels[component] = level
+	}
+}
+
+// ResetLevel makes a component follow the default level again
+func (l *Logger) ResetLevel(component string) {
+	l.cfg.mu.Lock()
+	defer l.cfg.mu.Unlock()
+	delete(l.cfg.levels, component)
+}
+
+// Levels returns the default level and the levels set per component
+func (l *Logger) Levels() (Level, map[string]Level) {
+	l.cfg.mu.RLock()
+	defer l.cfg.mu.RUnlock()
+	levels := make(map[string]Level, len(l.cfg.levels))
+	for component, level := range l.cfg.levels {
+		levels[component] = level
+	}
+	return l.cfg.level, levels
+}
+
+// SetFormat switches the output format of every logger sharing the root of l
+func (l *Logger) SetFormat(format Format) {
+	l.cfg.mu.Lock()
+	defer l.cfg.mu.Unlock()
+	l.cfg.format = format
+}
+
+// Enabled reports whether entries of level are written
+func (l *Logger) Enabled(level Level) bool {
+	if l == nil || level >= LevelOff {
+		return false
+	}
+	l.cfg.mu.RLock()
+	defer l.cfg.mu.RUnlock()
+	threshold, ok := l.cfg.levels[l.component]
+	if !ok {
+		threshold = l.cfg.level
+	}
+	return level >= threshold
+}
+
+// Debug logs step-by-step detail
+func (l *Logger) Debug(msg string, keyvals ...interface{}) { l.log(LevelDebug, msg, keyvals) }
+
+// Info logs normal operation
+func (l *Logger) Info(msg string, keyvals ...interface{}) { l.log(LevelInfo, msg, keyvals) }
+
+// Warn logs rejected input and recoverable problems
+func (l *Logger) Warn(msg string, keyvals ...interface{}) { l.log(LevelWarn, msg, keyvals) }
+
+// Error logs failures needing attention
+func (l *Logger) Error(msg string, keyvals ...interface{}) { l.log(LevelError, msg, keyvals) }
+
+func (l *Logger) log(level Level, msg string, keyvals []interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	l.cfg.mu.Lock()
+	defer l.cfg.mu.Unlock()
+	kv := append(append([]interface{}{}, l.attrs...), keyvals...)
+	if len(kv)%2 == 1 {
+		kv = append(kv, "(missing)")
+	}
+	now := l.cfg.now().UTC()
+	var line []byte
+	if l.cfg.format == FormatJSON {
+		line = l.jsonLine(now, level, msg, kv)
+	} else {
+		line = l.textLine(now, level, msg, kv)
+	}
+	l.cfg.out.Write(line)
+}
+
+// textLine formats: 2006-01-02T15:04:05.000Z INFO [component] message key=value
+func (l *Logger) textLine(now time.Time, level Level, msg string, kv []interface{}) []byte {
+	var b strings.Builder
+	b.WriteString(now.Format("2006-01-02T15:04:05.000Z07:00"))
+	b.WriteByte(' ')
+	b.WriteString(strings.ToUpper(level.String()))
+	if l.component != "" {
+		b.WriteString(" [")
+		b.WriteString(l.component)
+		b.WriteByte(']')
+	}
+	b.WriteByte(' ')
+	b.WriteString(msg)
+	for i := 0; i < len(kv); i += 2 {
+		b.WriteByte(' ')
+		b.WriteString(fmt.Sprint(kv[i]))
+		b.WriteByte('=')
+		b.WriteString(textValue(kv[i+1]))
+	}
+	b.WriteByte('\n')
+	return []byte(b.String())
+}
+
+// textValue formats a value, quoting it when it would be ambiguous
+func textValue(v interface{}) string {
+	var s string
+	switch v := v.(type) {
+	case string:
+		s = v
+	case error:
+		s = v.Error()
+	case fmt.Stringer:
+		s = v.String()
+	case float64:
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		s = fmt.Sprint(v)
+	}
+	if s == "" || strings.ContainsAny(s, " =\"\n\t") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// jsonLine formats an object with time, level, component and msg first, then the
+// attributes in order
+func (l *Logger) jsonLine(now time.Time, level Level, msg string, kv []interface{}) []byte {
+	var b strings.Builder
+	field := func(key string, value interface{}) {
+		k, _ := json.Marshal(key)
+		v, err := json.Marshal(jsonValue(value))
+		if err != nil {
+			v, _ = json.Marshal(fmt.Sprint(value))
+		}
+		if b.Len() > 1 {
+			b.WriteByte(',')
+		}
+		b.Write(k)
+		b.WriteByte(':')
+		b.Write(v)
+	}
+	b.WriteByte('{')
+	field("time", now.Format(time.RFC3339Nano))
+	field("level", level.String())
+	if l.component != "" {
+		field("component", l.component)
+	}
+	field("msg", msg)
+	seen := map[string]bool{"time": true, "level": true, "component": true, "msg": true}
+	for i := 0; i < len(kv); i += 2 {
+		key := fmt.Sprint(kv[i])
+		if seen[key] {
+			key = "attr." + key // Keep the fixed fields unambiguous
+		}
+		seen[key] = true
+		field(key, kv[i+1])
+	}
+	b.WriteString("}\n")
+	return []byte(b.String())
+}
+
+// jsonValue converts values JSON would encode poorly
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	}
+	return v
+}
+
+// ParseLevels parses a list like "pool=debug,mining=warn" into levels by component
+func ParseLevels(s string) (map[string]Level, error) {
+	levels := make(map[string]Level)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		component, name, ok := strings.Cut(part, "=")
+		if !ok || component == "" {
+			return nil, fmt.Errorf("invalid component level %q, want component=level", part)
+		}
+		level, err := ParseLevel(name)
+		if err != nil {
+			return nil, err
+		}
+		levels[component] = level
+	}
+	return levels, nil
+}
+
+// FormatLevels is the inverse of ParseLevels, components sorted by name
+func FormatLevels(levels map[string]Level) string {
+	components := make([]string, 0, len(levels))
+	for component := range levels {
+		components = append(components, component)
+	}
+	sort.Strings(components)
+	parts := make([]string, len(components))
+	for i, component := range components {
+		parts[i] = component + "=" + levels[component].String()
+	}
+	return strings.Join(parts, ",")
+}
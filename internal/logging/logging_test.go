@@ -0,0 +1,62 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestComponentLevelsAndFormats(t *testing.T) {
+	var out bytes.Buffer
+	root := New(&out, Options{Level: LevelInfo, Levels: map[string]Level{"pool": LevelWarn}})
+	root.cfg.now = func() time.Time { return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC) }
+	pool := root.Component("pool")
+	mining := root.Component("mining").With("miner", "abc")
+
+	pool.Info("hidden")
+	mining.Debug("hidden")
+	mining.Info("block mined", "height", 7, "hash", "00ff", "err", errors.New("stale tip"))
+	want := "2024-01-02T03:04:05.000Z INFO [mining] block mined miner=abc height=7 hash=00ff err=\"stale tip\"\n"
+	if out.String() != want {
+		t.Errorf("Unexpected text entry:\n got %q\nwant %q", out.String(), want)
+	}
+
+	out.Reset()
+	root.SetLevel("pool", LevelDebug)
+	root.SetFormat(FormatJSON)
+	pool.Debug("tx added", "size", 3, "msg", "shadowed")
+	var entry map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+		t.Fatalf("Expected a JSON entry, got %q: %v", out.String(), err)
+	}
+	if entry["level"] != "debug" || entry["component"] != "pool" || entry["msg"] != "tx added" || entry["size"] != 3.0 || entry["attr.msg"] != "shadowed" {
+		t.Errorf("Unexpected JSON entry %v", entry)
+	}
+
+	out.Reset()
+	root.SetLevel("", LevelOff)
+	root.ResetLevel("pool")
+	pool.Error("hidden")
+	if out.Len() != 0 {
+		t.Errorf("Expected nothing logged with level off, got %q", out.String())
+	}
+	var nilLogger *Logger
+	nilLogger.Component("api").Info("ignored")
+}
+
+func TestParseLevels(t *testing.T) {
+	levels, err := ParseLevels("pool=debug, mining=warn")
+	if err != nil {
+		t.Fatalf("ParseLevels failed: %v", err)
+	}
+	if got := FormatLevels(levels); got != "mining=warn,pool=debug" {
+		t.Errorf("Unexpected levels %q", got)
+	}
+	for _, bad := range []string{"pool", "pool=loud", "=info"} {
+		if _, err := ParseLevels(bad); err == nil {
+			t.Errorf("Expected %q to fail", bad)
+		}
+	}
+}
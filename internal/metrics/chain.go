@@ -0,0 +1,97 @@
+package metrics
+
+import (
+	"strings"
+	"unicode"
+	"unknownberrytrip/internal/blockchain"
+)
+
+// chainEventBuffer is the number of chain events queued for the collector; events
+// dropped beyond it are counted in unbt_metrics_events_dropped_total
+const chainEventBuffer = 4096
+
+// Buckets of the chain histograms
+var (
+	BlockIntervalBuckets = []float64{1, 2, 5, 10, 15, 20, 30, 60, 120, 300, 600}
+	BlockTxsBuckets      = []float64{0, 1, 5, 10, 50, 100, 500, 1000}
+)
+
+// RegisterChain registers the chain, pool and mining metrics of bc. Gauges are read
+// at scrape time; counters and histograms follow the chain events until stop is called.
+func RegisterChain(r *Registry, bc *blockchain.Blockchain) (stop func()) {
+	r.NewGaugeFunc("unbt_chain_height", "Height of the chain tip.", func() float64 {
+		return float64(bc.Head().Height)
+	})
+	r.NewGaugeFunc("unbt_chain_tip_timestamp_seconds", "Timestamp of the tip block.", func() float64 {
+		return float64(bc.Head().Timestamp)
+	})
+	r.NewGaugeFunc("unbt_pool_size", "Transactions waiting in the pool.", func() float64 {
+		return float64(bc.Head().PoolSize)
+	})
+	r.NewGaugeFunc("unbt_mining_hashrate", "Hashes per second of the last block mined by this node.", bc.Hashrate)
+	r.NewCounterFunc("unbt_mining_hashes_total", "Hashes computed by this node's miner.", func() float64 {
+		return float64(bc.TotalHashes())
+	})
+
+	blocks := r.NewCounter("unbt_blocks_imported_total", "Blocks appended to the chain.")
+	blocksRejected := r.NewCounter("unbt_blocks_rejected_total", "Mined or submitted blocks that failed to import.")
+	interval := r.NewHistogram("unbt_block_interval_seconds", "Time between the timestamps of consecutive blocks.", BlockIntervalBuckets)
+	blockTxs := r.NewHistogram("unbt_block_transactions", "Transactions per imported block.", BlockTxsBuckets)
+	accepted := r.NewCounter("unbt_pool_tx_accepted_total", "Transactions accepted into the pool.")
+	rejected := r.NewCounterVec("unbt_pool_tx_rejected_total", "Transactions refused by the pool, by reason.", "reason")
+	evicted := r.NewCounter("unbt_pool_tx_evicted_total", "Pooled transactions dropped because a block used their nonce.")
+	mining := r.NewGauge("unbt_mining_running", "Mining loops running on this node.")
+
+	lastTimestamp := bc.Head().Timestamp
+	sub := bc.Hook(chainEventBuffer, func(ev blockchain.Event) {
+		switch ev := ev.(type) {
+		case blockchain.BlockImported:
+			blocks.Inc()
+			blockTxs.Observe(float64(len(ev.Block.Transactions)))
+			interval.Observe(float64(ev.Block.Timestamp - lastTimestamp))
+			lastTimestamp = ev.Block.Timestamp
+		case blockchain.BlockRejected:
+			blocksRejected.Inc()
+		case blockchain.TxAccepted:
+			accepted.Inc()
+		case blockchain.TxRejected:
+			rejected.With(RejectReason(ev.Reason)).Inc()
+		case blockchain.TxEvicted:
+			evicted.Inc()
+		case blockchain.MiningStarted:
+			mining.Add(1)
+		case blockchain.MiningStopped:
+			mining.Add(-1)
+		}
+	})
+	r.NewCounterFunc("unbt_metrics_events_dropped_total", "Chain events missed by the metrics collector.", func() float64 {
+		return float64(sub.Dropped())
+	})
+	return sub.Unsubscribe
+}
+
+// RejectReason turns a rejection error into a label value: its error code in
+// lower case, else at most four leading words of its message, stopping at a
+// colon, at a word holding a digit or quote and before from, to or for, so values
+// and addresses never make new series
+func RejectReason(err error) string {
+	if code := blockchain.ErrorCode(err); code != "" {
+		return strings.ToLower(code)
+	}
+	var words []string
+	for _, word := range strings.Fields(strings.ToLower(err.Error())) {
+		if word == "from" || word == "to" || word == "for" ||
+			strings.IndexFunc(word, func(r rune) bool { return unicode.IsDigit(r) || r == '"' }) >= 0 {
+			break
+		}
+		trimmed := strings.TrimSuffix(word, ":")
+		words = append(words, trimmed)
+		if trimmed != word || len(words) == 4 {
+			break
+		}
+	}
+	if len(words) == 0 {
+		return "other"
+	}
+	return strings.Join(words, "_")
+}
@@ -0,0 +1,365 @@
+// Package metrics implements counters, gauges and histograms exposed in the
+// Prometheus text exposition format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Registry holds metrics and writes them in name order
+type Registry struct {
+	mu      sync.Mutex
+	metrics map[string]metric
+}
+
+// metric is a named family of samples
+type metric interface {
+	header() (help, kind string)
+	samples(name string, b *strings.Builder)
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]metric)}
+}
+
+// register adds m under name; registering a name twice is a programming error
+func (r *Registry) register(name string, m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.metrics[name]; ok {
+		panic("metrics: duplicate metric " + name)
+	}
+	r.metrics[name] = m
+}
+
+// WriteTo writes every metric in the text exposition format
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	names := make([]string, 0, len(r.metrics))
+	for name := range r.metrics {
+		names = append(names, name)
+	}
+	metrics := make([]metric, len(names))
+	sort.Strings(names)
+	for i, name := range names {
+		metrics[i] = r.metrics[name]
+	}
+	r.mu.Unlock()
+
+	var b strings.Builder
+	for i, name := range names {
+		help, kind := metrics[i].header()
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, escapeHelp(help), name, kind)
+		metrics[i].samples(name, &b)
+	}
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// Handler serves the registry to Prometheus scrapers
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteTo(w)
+	})
+}
+
+// Counter is a value that only goes up
+type Counter struct {
+	mu    sync.Mutex
+	value float64
+}
+
+// Inc adds one
+func (c *Counter) Inc() { c.Add(1) }
+
+// Add adds v, which must not be negative
+func (c *Counter) Add(v float64) {
+	if v < 0 {
+		return
+	}
+	c.mu.Lock()
+	c.value += v
+	c.mu.Unlock()
+}
+
+// Value returns the current count
+func (c *Counter) Value() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.value
+}
+
+// Gauge is a value that goes up and down
+type Gauge struct {
+	mu    sync.Mutex
+	value float64
+}
+
+// Set sets the value
+func (g *Gauge) Set(v float64) {
+	g.mu.Lock()
+	g.value = v
+	g.mu.Unlock()
+}
+
+// Add adds v, which may be negative
+func (g *Gauge) Add(v float64) {
+	g.mu.Lock()
+	g.value += v
+	g.mu.Unlock()
+}
+
+// Value returns the current value
+func (g *Gauge) Value() float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.value
+}
+
+// Histogram counts observations in cumulative buckets
+type Histogram struct {
+	mu      sync.Mutex
+	bounds  []float64 // Upper bounds, ascending, without +Inf
+	buckets []uint64  // Observations per bound, not cumulative
+	count   uint64
+	sum     float64
+}
+
+func newHistogram(bounds []float64) *Histogram {
+	return &Histogram{bounds: bounds, buckets: make([]uint64, len(bounds))}
+}
+
+// Observe records v
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.bounds, v)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if i < len(h.buckets) {
+		h.buckets[i]++
+	}
+	h.count++
+	h.sum += v
+}
+
+// Count returns the number of observations
+func (h *Histogram) Count() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.count
+}
+
+func (h *Histogram) write(name string, labels []string, values []string, b *strings.Builder) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	leLabels := append(append([]string(nil), labels...), "le")
+	leValues := append(append([]string(nil), values...), "")
+	var cumulative uint64
+	for i, bound := range h.bounds {
+		cumulative += h.buckets[i]
+		leValues[len(values)] = formatFloat(bound)
+		writeSample(b, name+"_bucket", leLabels, leValues, float64(cumulative))
+	}
+	leValues[len(values)] = "+Inf"
+	writeSample(b, name+"_bucket", leLabels, leValues, float64(h.count))
+	writeSample(b, name+"_sum", labels, values, h.sum)
+	writeSample(b, name+"_count", labels, values, float64(h.count))
+}
+
+// vec holds one child per label value combination
+type vec[T any] struct {
+	mu       sync.Mutex
+	labels   []string
+	children map[string]*child[T]
+	create   func() T
+}
+
+type child[T any] struct {
+	values []string
+	metric T
+}
+
+func newVec[T any](labels []string, create func() T) *vec[T] {
+	return &vec[T]{labels: labels, children: make(map[string]*child[T]), create: create}
+}
+
+// with returns the child for the label values, creating it on first use
+func (v *vec[T]) with(values []string) T {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: got %d label values for %d labels", len(values), len(v.labels)))
+	}
+	key := strings.Join(values, "\xff")
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	c, ok := v.children[key]
+	if !ok {
+		c = &child[T]{values: append([]string(nil), values...), metric: v.create()}
+		v.children[key] = c
+	}
+	return c.metric
+}
+
+// each calls fn for every child in label value order
+func (v *vec[T]) each(fn func(values []string, metric T)) {
+	v.mu.Lock()
+	keys := make([]string, 0, len(v.children))
+	for key := range v.children {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	children := make([]*child[T], len(keys))
+	for i, key := range keys {
+		children[i] = v.children[key]
+	}
+	v.mu.Unlock()
+	for _, c := range children {
+		fn(c.values, c.metric)
+	}
+}
+
+// CounterVec is a counter partitioned by labels
+type CounterVec struct {
+	help string
+	v    *vec[*Counter]
+}
+
+// With returns the counter for the label values
+func (c *CounterVec) With(values ...string) *Counter { return c.v.with(values) }
+
+func (c *CounterVec) header() (string, string) { return c.help, "counter" }
+
+func (c *CounterVec) samples(name string, b *strings.Builder) {
+	c.v.each(func(values []string, counter *Counter) {
+		writeSample(b, name, c.v.labels, values, counter.Value())
+	})
+}
+
+// HistogramVec is a histogram partitioned by labels
+type HistogramVec struct {
+	help string
+	v    *vec[*Histogram]
+}
+
+// With returns the histogram for the label values
+func (h *HistogramVec) With(values ...string) *Histogram { return h.v.with(values) }
+
+func (h *HistogramVec) header() (string, string) { return h.help, "histogram" }
+
+func (h *HistogramVec) samples(name string, b *strings.Builder) {
+	h.v.each(func(values []string, histogram *Histogram) {
+		histogram.write(name, h.v.labels, values, b)
+	})
+}
+
+// single adapts an unlabelled metric to the metric interface
+type single struct {
+	help, kind string
+	write      func(name string, b *strings.Builder)
+}
+
+func (s single) header() (string, string)                { return s.help, s.kind }
+func (s single) samples(name string, b *strings.Builder) { s.write(name, b) }
+
+// NewCounter registers a counter
+func (r *Registry) NewCounter(name, help string) *Counter {
+	c := &Counter{}
+	r.register(name, single{help, "counter", func(name string, b *strings.Builder) {
+		writeSample(b, name, nil, nil, c.Value())
+	}})
+	return c
+}
+
+// NewCounterFunc registers a counter read from fn at scrape time
+func (r *Registry) NewCounterFunc(name, help string, fn func() float64) {
+	r.register(name, single{help, "counter", func(name string, b *strings.Builder) {
+		writeSample(b, name, nil, nil, fn())
+	}})
+}
+
+// NewCounterVec registers a counter partitioned by labels
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{help: help, v: newVec(labels, func() *Counter { return &Counter{} })}
+	r.register(name, c)
+	return c
+}
+
+// NewGauge registers a gauge
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	g := &Gauge{}
+	r.register(name, single{help, "gauge", func(name string, b *strings.Builder) {
+		writeSample(b, name, nil, nil, g.Value())
+	}})
+	return g
+}
+
+// NewGaugeFunc registers a gauge read from fn at scrape time
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	r.register(name, single{help, "gauge", func(name string, b *strings.Builder) {
+		writeSample(b, name, nil, nil, fn())
+	}})
+}
+
+// NewHistogram registers a histogram with the given ascending bucket bounds
+func (r *Registry) NewHistogram(name, help string, buckets []float64) *Histogram {
+	h := newHistogram(buckets)
+	r.register(name, single{help, "histogram", func(name string, b *strings.Builder) {
+		h.write(name, nil, nil, b)
+	}})
+	return h
+}
+
+// NewHistogramVec registers a histogram partitioned by labels
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{help: help, v: newVec(labels, func() *Histogram { return newHistogram(buckets) })}
+	r.register(name, h)
+	return h
+}
+
+// writeSample writes one sample line
+func writeSample(b *strings.Builder, name string, labels, values []string, value float64) {
+	b.WriteString(name)
+	if len(labels) > 0 {
+		b.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(label)
+			b.WriteString(`="`)
+			b.WriteString(escapeLabel(values[i]))
+			b.WriteByte('"')
+		}
+		b.WriteByte('}')
+	}
+	b.WriteByte(' ')
+	b.WriteString(formatFloat(value))
+	b.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"unknownberrytrip/internal/blockchain"
+)
+
+func TestExpositionFormat(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounterVec("test_rejected_total", "Rejected, by reason.", "reason")
+	c.With("invalid nonce").Inc()
+	c.With(`quote"d`).Add(2)
+	g := r.NewGauge("test_size", "Size.")
+	g.Set(3)
+	h := r.NewHistogram("test_seconds", "Latency\nin seconds.", []float64{0.1, 1})
+	h.Observe(0.05)
+	h.Observe(0.5)
+	h.Observe(7)
+
+	var b strings.Builder
+	r.WriteTo(&b)
+	want := `# HELP test_rejected_total Rejected, by reason.
+# TYPE test_rejected_total counter
+test_rejected_total{reason="invalid nonce"} 1
+test_rejected_total{reason="quote\"d"} 2
+# HELP test_seconds Latency\nin seconds.
+# TYPE test_seconds histogram
+test_seconds_bucket{le="0.1"} 1
+test_seconds_bucket{le="1"} 2
+test_seconds_bucket{le="+Inf"} 3
+test_seconds_sum 7.55
+test_seconds_count 3
+# HELP test_size Size.
+# TYPE test_size gauge
+test_size 3
+`
+	if b.String() != want {
+		t.Errorf("Unexpected exposition:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
+
+func TestRejectReason(t *testing.T) {
+	cases := map[string]string{
+		"invalid nonce":                                   "invalid_nonce",
+		"insufficient capacity: delegating 5 BP":          "insufficient_capacity",
+		"no delegation from alice to bob":                 "no_delegation",
+		`unknown transaction type "swap"`:                 "unknown_transaction_type",
+		"delegation expires at height 7, already reached": "delegation_expires_at_height",
+		"42": "other",
+	}
+	for msg, want := range cases {
+		if got := RejectReason(errors.New(msg)); got != want {
+			t.Errorf("RejectReason(%q) = %q, want %q", msg, got, want)
+		}
+	}
+	wrapped := fmt.Errorf("tx #0: %w: expected 3, got 1", blockchain.ErrNonceTooLow)
+	if got := RejectReason(wrapped); got != "nonce_too_low" {
+		t.Errorf("Expected the error code as reason, got %q", got)
+	}
+}
@@ -0,0 +1,261 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"unknownberrytrip/internal/api"
+	"unknownberrytrip/internal/blockchain"
+	"unknownberrytrip/internal/logging"
+	"unknownberrytrip/internal/pool"
+)
+
+// shutdownTimeout bounds how long Stop waits for in-flight API requests
+const shutdownTimeout = 5 * time.Second
+
+// Config configures a node
+type Config struct {
+	APIAddr        string          // API listen address, e.g. ":8080"
+	MinerAddress   string          // Address receiving rewards, empty disables mining
+	MiningInterval time.Duration   // Time between mining attempts, 0 for the default
+	StatePath      string          // File the state is flushed to on Stop, empty disables it
+	PoolAddr       string          // Mining pool listen address, empty disables the pool
+	PoolOperator   string          // Address paid by pool blocks without shares
+	AssertSupply   bool            // Audit supply after every block and stop on violation
+	Logger         *logging.Logger // Root logger of the node components, nil for logging.Default()
+	MaxTipAge      time.Duration   // Tip age making the node unready while transactions wait, 0 for the default
+	ControlToken   string          // Bearer token for the control methods, empty limits them to loopback clients
+	AllowedOrigins []string        // Browser origins besides the API's own allowed to open /ws
+}
+
+// Node runs the API server and the miner on top of a blockchain
+type Node struct {
+	bc       *blockchain.Blockchain
+	cfg      Config
+	log      *logging.Logger
+	api      *api.Server
+	pool     *pool.Server
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	state    nodeState
+	ctx      context.Context // Lives until the node stops
+	mining   *miningRun      // Current mining loop, nil when not mining
+	stopOnce sync.Once
+	stopErr  error // Result of the shutdown, returned to every Stop caller
+}
+
+// miningRun is a running mining loop
+type miningRun struct {
+	address string
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+type nodeState int
+
+const (
+	stateNew nodeState = iota
+	stateRunning
+	stateStopped
+)
+
+// New creates a node for bc
+func New(bc *blockchain.Blockchain, cfg Config) *Node {
+	if cfg.MiningInterval == 0 {
+		cfg.MiningInterval = blockchain.MiningInterval
+	}
+	if cfg.AssertSupply {
+		bc.AssertSupply = true
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = logging.Default()
+	}
+	bc.SetLogger(cfg.Logger)
+	return &Node{bc: bc, cfg: cfg, log: cfg.Logger.Component("node")}
+}
+
+// Blockchain returns the chain served by the node
+func (n *Node) Blockchain() *blockchain.Blockchain {
+	return n.bc
+}
+
+// APIAddr returns the address the API is bound to
+func (n *Node) APIAddr() string {
+	return n.api.Addr()
+}
+
+// Start starts the API server and the miner. The node stops by itself when ctx is
+// done or the chain halts on a supply violation.
+func (n *Node) Start(ctx context.Context) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.state != stateNew {
+		return fmt.Errorf("node already started")
+	}
+
+	n.api = api.NewServer(n.bc, n.cfg.APIAddr)
+	n.api.SetMiningControl(n)
+	n.api.SetControlOptions(api.ControlOptions{
+		Token:          n.cfg.ControlToken,
+		MinerAddress:   n.cfg.MinerAddress,
+		AllowedOrigins: n.cfg.AllowedOrigins,
+	})
+	n.api.SetLogger(n.cfg.Logger)
+	health := api.HealthOptions{MaxTipAge: n.cfg.MaxTipAge}
+	if n.cfg.StatePath != "" {
+		health.Storage = n.checkStorage
+	}
+	n.api.SetHealthOptions(health)
+	if err := n.api.Start(); err != nil {
+		return fmt.Errorf("start API: %w", err)
+	}
+	n.log.Info("API listening", "addr", n.api.Addr())
+	if n.cfg.PoolAddr != "" {
+		poolCfg := pool.DefaultConfig(n.cfg.PoolAddr, n.cfg.PoolOperator)
+		poolCfg.Logger = n.cfg.Logger
+		n.pool = pool.NewServer(n.bc, poolCfg)
+		if err := n.pool.Start(); err != nil {
+			n.api.Shutdown(context.Background())
+			return fmt.Errorf("start pool: %w", err)
+		}
+	}
+
+	ctx, n.cancel = context.WithCancel(ctx)
+	n.ctx = ctx
+	if n.cfg.MinerAddress != "" {
+		n.startMining(n.cfg.MinerAddress)
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-n.bc.Halted():
+		}
+		n.Stop()
+	}()
+	n.state = stateRunning
+	return nil
+}
+
+// Stop shuts down the API server, aborts mining and flushes the pool and state to
+// disk. It waits for all node goroutines to exit and is safe to call more than
+// once: every call after Start returns the result of the first shutdown.
+func (n *Node) Stop() error {
+	n.mu.Lock()
+	started := n.state != stateNew
+	n.mu.Unlock()
+	if !started {
+		return nil
+	}
+	n.stopOnce.Do(func() { n.stopErr = n.stop() })
+	return n.stopErr
+}
+
+// stop runs the shutdown. n.mu is released first, so control requests still in
+// flight can finish while the API drains.
+func (n *Node) stop() error {
+	n.mu.Lock()
+	n.state = stateStopped
+	n.mu.Unlock()
+	n.log.Info("Stopping")
+
+	n.cancel()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	apiErr := n.api.Shutdown(shutdownCtx)
+	if n.pool != nil {
+		n.pool.Close()
+	}
+	n.wg.Wait()
+
+	if n.cfg.StatePath != "" {
+		if err := n.bc.SaveToFile(n.cfg.StatePath); err != nil {
+			return fmt.Errorf("flush state: %w", err)
+		}
+	}
+	if apiErr != nil {
+		return fmt.Errorf("shutdown API: %w", apiErr)
+	}
+	n.log.Info("Stopped")
+	return nil
+}
+
+// StartMining starts the mining loop paying address, or the configured miner
+// address when empty
+func (n *Node) StartMining(address string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.state != stateRunning {
+		return fmt.Errorf("node not running")
+	}
+	if n.mining != nil {
+		return fmt.Errorf("already mining to %s", n.mining.address)
+	}
+	if address == "" {
+		address = n.cfg.MinerAddress
+	}
+	if address == "" {
+		return fmt.Errorf("no miner address")
+	}
+	n.startMining(address)
+	return nil
+}
+
+// startMining runs the mining loop until StopMining or the node stops; n.mu is held
+func (n *Node) startMining(address string) {
+	ctx, cancel := context.WithCancel(n.ctx)
+	run := &miningRun{address: address, cancel: cancel, done: make(chan struct{})}
+	n.mining = run
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		defer close(run.done)
+		n.bc.RunMining(ctx, address, n.cfg.MiningInterval)
+	}()
+}
+
+// StopMining stops the mining loop and waits for it to exit
+func (n *Node) StopMining() error {
+	n.mu.Lock()
+	run := n.mining
+	n.mining = nil
+	n.mu.Unlock()
+	if run == nil {
+		return fmt.Errorf("not mining")
+	}
+	run.cancel()
+	<-run.done
+	return nil
+}
+
+// MiningStatus reports whether the node is mining
+func (n *Node) MiningStatus() api.MiningStatus {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	status := api.MiningStatus{Hashrate: n.bc.Hashrate()}
+	if n.mining != nil {
+		status.Address = n.mining.address
+		select {
+		case <-n.mining.done:
+			status.Failed = n.state == stateRunning
+		default:
+			status.Running = true
+		}
+	}
+	return status
+}
+
+// checkStorage verifies that the state directory accepts new files, as SaveToFile
+// needs to write its temporary file there
+func (n *Node) checkStorage() error {
+	f, err := os.CreateTemp(filepath.Dir(n.cfg.StatePath), ".health-*")
+	if err != nil {
+		return fmt.Errorf("state directory not writable: %w", err)
+	}
+	name := f.Name()
+	f.Close()
+	return os.Remove(name)
+}
@@ -0,0 +1,143 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unknownberrytrip/internal/api"
+	"unknownberrytrip/internal/blockchain"
+	"unknownberrytrip/internal/wallet"
+)
+
+func TestNodeStartStop(t *testing.T) {
+	bc := blockchain.NewBlockchain()
+	senderWallet := wallet.NewWallet()
+	bc.Balances[senderWallet.Address] = 10.0
+
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	n := New(bc, Config{
+		APIAddr:        "127.0.0.1:0",
+		MinerAddress:   "miner",
+		MiningInterval: 10 * time.Millisecond,
+		StatePath:      statePath,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := n.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	addr := n.APIAddr()
+	t.Logf("API bound to %s", addr)
+
+	tx := senderWallet.CreateTransaction("receiver", 1.0, 0)
+	if err := bc.AddTransactionToPool(*tx); err != nil {
+		t.Fatalf("AddTransactionToPool failed: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for bc.Height() < 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Log("Stopping the node through its context")
+	cancel()
+	if err := n.Stop(); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+	if conn, err := net.Dial("tcp", addr); err == nil {
+		conn.Close()
+		t.Error("Expected API port to be closed after Stop")
+	}
+
+	loaded, err := blockchain.LoadBlockchain(statePath)
+	if err != nil {
+		t.Fatalf("LoadBlockchain failed: %v", err)
+	}
+	if len(loaded.Chain) != 2 || loaded.Balances["receiver"] != 1.0 {
+		t.Errorf("Expected flushed chain with the mined transfer, got %d blocks and receiver balance %f", len(loaded.Chain), loaded.Balances["receiver"])
+	}
+	if _, _, _, ok := loaded.GetTransaction(tx.ID()); !ok {
+		t.Error("Expected transaction index to be rebuilt on load")
+	}
+}
+
+func TestNodeMiningControl(t *testing.T) {
+	bc := blockchain.NewBlockchain()
+	n := New(bc, Config{APIAddr: "127.0.0.1:0", MiningInterval: 10 * time.Millisecond})
+	if err := n.StartMining("miner"); err == nil {
+		t.Error("Expected StartMining to fail before Start")
+	}
+	if err := n.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer n.Stop()
+
+	if n.MiningStatus().Running {
+		t.Fatal("Expected no mining without a miner address")
+	}
+	if err := n.StartMining(""); err == nil {
+		t.Error("Expected StartMining without any address to fail")
+	}
+	if err := n.StartMining("miner"); err != nil {
+		t.Fatalf("StartMining failed: %v", err)
+	}
+	if err := n.StartMining("other"); err == nil {
+		t.Error("Expected a second StartMining to fail")
+	}
+	if status := n.MiningStatus(); !status.Running || status.Address != "miner" {
+		t.Errorf("Expected mining to miner, got %+v", status)
+	}
+	if err := n.StopMining(); err != nil {
+		t.Fatalf("StopMining failed: %v", err)
+	}
+	if n.MiningStatus().Running {
+		t.Error("Expected mining to stop")
+	}
+	if err := n.StopMining(); err == nil {
+		t.Error("Expected StopMining to fail when not mining")
+	}
+}
+
+func TestNodeStopReleasesLockAndKeepsError(t *testing.T) {
+	bc := blockchain.NewBlockchain()
+	n := New(bc, Config{
+		APIAddr:   "127.0.0.1:0",
+		StatePath: filepath.Join(t.TempDir(), "missing", "state.json"),
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := n.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	t.Log("Holding a request in flight so the API drains while the node stops")
+	conn, err := net.Dial("tcp", n.APIAddr())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+	fmt.Fprint(conn, "POST /rpc HTTP/1.1\r\nHost: node\r\nContent-Type: application/json\r\nContent-Length: 100\r\n\r\n{")
+	time.Sleep(50 * time.Millisecond)
+
+	cancel() // The watcher stops the node first
+	time.Sleep(50 * time.Millisecond)
+	status := make(chan api.MiningStatus)
+	go func() { status <- n.MiningStatus() }()
+	select {
+	case <-status:
+	case <-time.After(time.Second):
+		t.Fatal("Expected MiningStatus to answer while the API drains")
+	}
+	conn.Close()
+
+	first := n.Stop()
+	if first == nil || !strings.Contains(first.Error(), "flush state") {
+		t.Fatalf("Expected the flush error from the watcher's stop, got %v", first)
+	}
+	if err := n.Stop(); err != first {
+		t.Errorf("Expected every Stop to return %v, got %v", first, err)
+	}
+}
@@ -0,0 +1,97 @@
+package pool
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math"
+)
+
+// Miners and the pool exchange one JSON object per line. Miners send Requests and
+// get a Response with the same ID; the pool pushes Notifications with a Method.
+//
+//	-> {"ID":1,"Method":"login","Params":{"Address":"<payout address>"}}
+//	<- {"ID":1,"Result":{"Accepted":true}}
+//	<- {"Method":"job","Params":{"JobID":"...","HeaderPrefix":"...","ShareTarget":...}}
+//	-> {"ID":2,"Method":"submit","Params":{"JobID":"...","Nonce":123}}
+//	<- {"ID":2,"Result":{"Accepted":true,"Block":false}}
+//	<- {"ID":3,"Error":"stale share"}
+//
+// A share is a nonce from the miner's range such that the first 4 bytes of
+// SHA-256(HeaderPrefix || nonce as 8 big-endian bytes), read as a big-endian
+// uint32, are below ShareTarget.
+
+// Request is a message sent by a miner
+type Request struct {
+	ID     int
+	Method string // "login" or "submit"
+	Params json.RawMessage
+}
+
+// LoginParams identifies the address paid for the miner's shares
+type LoginParams struct {
+	Address string
+}
+
+// SubmitParams carries a share
+type SubmitParams struct {
+	JobID string
+	Nonce uint64
+}
+
+// Response answers a Request
+type Response struct {
+	ID     int
+	Result *Result `json:",omitempty"`
+	Error  string  `json:",omitempty"`
+}
+
+// Result is the outcome of a login or submit
+type Result struct {
+	Accepted bool
+	Block    bool // The share also solved a block
+}
+
+// Notification is pushed by the pool
+type Notification struct {
+	Method string // "job"
+	Params Job
+}
+
+// Job is work for a single miner
+type Job struct {
+	JobID           string
+	Height          int
+	HeaderPrefix    string  // Hex-encoded header without the nonce
+	Difficulty      float64 // Share difficulty assigned by vardiff
+	ShareTarget     uint32  // Share hash value bound for Difficulty
+	BlockDifficulty float64 // Difficulty of a block solution
+	NonceStart      uint64  // First nonce of the miner's range
+	NonceEnd        uint64  // End of the miner's range, exclusive
+}
+
+// Message is any line received by a miner: a Response or a Notification
+type Message struct {
+	ID     int
+	Method string
+	Params Job
+	Result *Result
+	Error  string
+}
+
+// ShareTarget returns the hash value bound for a share difficulty
+func ShareTarget(difficulty float64) uint32 {
+	if difficulty <= 1 {
+		return math.MaxUint32
+	}
+	return uint32(float64(1<<32) / difficulty)
+}
+
+// BlockDifficulty converts a block difficulty in leading zero hex digits to a share difficulty
+func BlockDifficulty(zeros int) float64 {
+	return math.Pow(16, float64(zeros))
+}
+
+// HashValue returns the value compared against a share target
+func HashValue(hash [32]byte) uint32 {
+	return binary.BigEndian.Uint32(hash[:4])
+}
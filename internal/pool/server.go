@@ -0,0 +1,455 @@
+package pool
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"sync"
+	"time"
+	"unknownberrytrip/internal/blockchain"
+	"unknownberrytrip/internal/logging"
+)
+
+// nonceRangeBits is the size of the nonce range handed to each miner
+const nonceRangeBits = 40
+
+// Config configures a pool server
+type Config struct {
+	Addr              string          // TCP listen address
+	Operator          string          // Block miner field, paid the reward when no shares were submitted
+	InitialDifficulty float64         // Share difficulty of new miners
+	MinDifficulty     float64         // Lowest share difficulty vardiff assigns
+	TargetShareTime   time.Duration   // Vardiff aims for one share per miner every TargetShareTime
+	RetargetInterval  time.Duration   // How often vardiff re-evaluates miners
+	JobRefresh        time.Duration   // How often jobs are rebuilt with new transactions and payouts
+	Logger            *logging.Logger // Root logger, nil for logging.Default(); entries use the stratum component
+}
+
+// DefaultConfig returns a pool configuration listening on addr and paying operator
+func DefaultConfig(addr, operator string) Config {
+	return Config{
+		Addr:              addr,
+		Operator:          operator,
+		InitialDifficulty: 4,
+		MinDifficulty:     1,
+		TargetShareTime:   5 * time.Second,
+		RetargetInterval:  30 * time.Second,
+		JobRefresh:        10 * time.Second,
+	}
+}
+
+// Server is a mining pool. Block rewards are paid in the coinbase in proportion to
+// the difficulty-weighted shares the round held when the job was built; shares
+// accepted later are paid by a later block.
+type Server struct {
+	bc       *blockchain.Blockchain
+	cfg      Config
+	listener net.Listener
+	log      *logging.Logger
+
+	mu        sync.Mutex
+	job       *job               // Latest job
+	jobs      map[string]*job    // Jobs on the current tip by ID
+	shares    map[string]float64 // Share weight per address in the current round
+	seen      map[string]bool    // Submitted job/nonce pairs on the current tip
+	clients   map[*client]bool
+	nextRange uint64
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+type job struct {
+	id              string
+	height          int
+	prefix          []byte
+	blockDifficulty float64
+	paid            map[string]float64 // Share weights the coinbase pays, nil when it pays the operator
+}
+
+type client struct {
+	conn    net.Conn
+	writeMu sync.Mutex
+	enc     *json.Encoder
+
+	// Guarded by Server.mu
+	address      string
+	difficulty   float64
+	nonceStart   uint64
+	sharesCount  int
+	lastRetarget time.Time
+}
+
+// NewServer creates a pool server mining on bc
+func NewServer(bc *blockchain.Blockchain, cfg Config) *Server {
+	logger := cfg.Logger
+	if logger == nil {
+		logger = logging.Default()
+	}
+	return &Server{
+		bc:      bc,
+		cfg:     cfg,
+		log:     logger.Component("stratum"),
+		jobs:    make(map[string]*job),
+		shares:  make(map[string]float64),
+		seen:    make(map[string]bool),
+		clients: make(map[*client]bool),
+		quit:    make(chan struct{}),
+	}
+}
+
+// Start binds the listening address and serves miners in the background
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.cfg.Addr)
+	if err != nil {
+		return err
+	}
+	s.listener = listener
+	s.refreshJob(true)
+
+	s.wg.Add(2)
+	go s.acceptLoop()
+	go s.jobLoop()
+	s.log.Info("Listening", "addr", listener.Addr().String())
+	return nil
+}
+
+// Addr returns the bound address
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Close disconnects all miners and waits for the server goroutines to exit
+func (s *Server) Close() error {
+	close(s.quit)
+	err := s.listener.Close()
+	s.mu.Lock()
+	for c := range s.clients {
+		c.conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) acceptLoop() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			select {
+			case <-s.quit:
+				return
+			default:
+			}
+			s.log.Warn("Accept failed", "err", err)
+			continue
+		}
+		c := &client{conn: conn, enc: json.NewEncoder(conn)}
+		s.mu.Lock()
+		s.clients[c] = true
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go s.serve(c)
+	}
+}
+
+// jobLoop rebuilds jobs when the tip changes or on a timer, and runs vardiff
+func (s *Server) jobLoop() {
+	defer s.wg.Done()
+	refresh := time.NewTicker(s.cfg.JobRefresh)
+	defer refresh.Stop()
+	retarget := time.NewTicker(s.cfg.RetargetInterval)
+	defer retarget.Stop()
+	for {
+		select {
+		case <-s.quit:
+			return
+		case <-s.bc.TipChanged():
+			s.refreshJob(true)
+		case <-refresh.C:
+			s.refreshJob(false)
+		case <-retarget.C:
+			s.retargetAll()
+		}
+	}
+}
+
+// refreshJob builds a job paying the current round and sends it to every miner.
+// When the tip changed, jobs on the old tip become stale.
+func (s *Server) refreshJob(newTip bool) {
+	var paid map[string]float64
+	tmpl := s.bc.GetBlockTemplate(s.cfg.Operator, func(total float64) []blockchain.Payout {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		payouts := s.payouts(total)
+		if payouts != nil {
+			paid = make(map[string]float64, len(s.shares))
+			for address, weight := range s.shares {
+				paid[address] = weight
+			}
+		}
+		return payouts
+	})
+	prefix, _ := hex.DecodeString(tmpl.HeaderPrefix)
+	j := &job{id: tmpl.ID, height: tmpl.Index, prefix: prefix, blockDifficulty: BlockDifficulty(tmpl.Difficulty), paid: paid}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if newTip {
+		s.jobs = make(map[string]*job)
+		s.seen = make(map[string]bool)
+	}
+	s.jobs[j.id] = j
+	s.job = j
+	for c := range s.clients {
+		if c.address != "" {
+			s.sendJob(c)
+		}
+	}
+}
+
+// payouts splits a block's coinbase value over the round's shares, nil when there
+// are none; s.mu must be held
+func (s *Server) payouts(reward float64) []blockchain.Payout {
+	total := 0.0
+	addresses := make([]string, 0, len(s.shares))
+	for address, weight := range s.shares {
+		total += weight
+		addresses = append(addresses, address)
+	}
+	if total == 0 {
+		return nil
+	}
+	sort.Strings(addresses)
+
+	payouts := make([]blockchain.Payout, len(addresses))
+	paid := 0.0
+	for i, address := range addresses {
+		amount := reward * s.shares[address] / total
+		if i == len(addresses)-1 {
+			amount = reward - paid // Rounding remainder goes to the last payout
+		}
+		payouts[i] = blockchain.Payout{Address: address, Amount: amount}
+		paid += amount
+	}
+	return payouts
+}
+
+// sendJob pushes the current job to a miner; s.mu must be held
+func (s *Server) sendJob(c *client) {
+	j := s.job
+	difficulty := c.difficulty
+	if difficulty > j.blockDifficulty {
+		difficulty = j.blockDifficulty
+	}
+	s.send(c, Notification{Method: "job", Params: Job{
+		JobID:           j.id,
+		Height:          j.height,
+		HeaderPrefix:    hex.EncodeToString(j.prefix),
+		Difficulty:      difficulty,
+		ShareTarget:     ShareTarget(difficulty),
+		BlockDifficulty: j.blockDifficulty,
+		NonceStart:      c.nonceStart,
+		NonceEnd:        c.nonceStart + 1<<nonceRangeBits,
+	}})
+}
+
+func (s *Server) send(c *client, v interface{}) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if err := c.enc.Encode(v); err != nil {
+		c.conn.Close()
+	}
+}
+
+func (s *Server) serve(c *client) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, c)
+		s.mu.Unlock()
+		c.conn.Close()
+	}()
+
+	scanner := bufio.NewScanner(c.conn)
+	for scanner.Scan() {
+		var req Request
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			s.send(c, Response{Error: "invalid request"})
+			continue
+		}
+		var resp Response
+		switch req.Method {
+		case "login":
+			resp = s.login(c, req)
+		case "submit":
+			resp = s.submit(c, req)
+		default:
+			resp = Response{Error: fmt.Sprintf("unknown method %q", req.Method)}
+		}
+		resp.ID = req.ID
+		s.send(c, resp)
+		if req.Method == "login" && resp.Error == "" {
+			s.mu.Lock()
+			s.sendJob(c)
+			s.mu.Unlock()
+		}
+	}
+}
+
+func (s *Server) login(c *client, req Request) Response {
+	var params LoginParams
+	if err := json.Unmarshal(req.Params, &params); err != nil || params.Address == "" {
+		return Response{Error: "payout address required"}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c.address != "" {
+		return Response{Error: "already logged in"}
+	}
+	c.address = params.Address
+	c.difficulty = s.cfg.InitialDifficulty
+	c.nonceStart = s.nextRange << nonceRangeBits
+	c.lastRetarget = time.Now()
+	s.nextRange++
+	s.log.Info("Miner logged in", "miner", c.address, "remote", c.conn.RemoteAddr().String())
+	return Response{Result: &Result{Accepted: true}}
+}
+
+func (s *Server) submit(c *client, req Request) Response {
+	var params SubmitParams
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return Response{Error: "invalid submit params"}
+	}
+
+	s.mu.Lock()
+	if c.address == "" {
+		s.mu.Unlock()
+		return Response{Error: "not logged in"}
+	}
+	j, ok := s.jobs[params.JobID]
+	if !ok {
+		s.mu.Unlock()
+		return Response{Error: "stale share"}
+	}
+	if params.Nonce < c.nonceStart || params.Nonce >= c.nonceStart+1<<nonceRangeBits {
+		s.mu.Unlock()
+		return Response{Error: "nonce out of range"}
+	}
+	key := fmt.Sprintf("%s:%d", params.JobID, params.Nonce)
+	if s.seen[key] {
+		s.mu.Unlock()
+		return Response{Error: "duplicate share"}
+	}
+
+	buf := make([]byte, len(j.prefix)+8)
+	copy(buf, j.prefix)
+	binary.BigEndian.PutUint64(buf[len(j.prefix):], params.Nonce)
+	value := HashValue(sha256.Sum256(buf))
+	difficulty := c.difficulty
+	if difficulty > j.blockDifficulty {
+		difficulty = j.blockDifficulty
+	}
+	if value >= ShareTarget(difficulty) {
+		s.mu.Unlock()
+		return Response{Error: "low difficulty share"}
+	}
+	s.seen[key] = true
+	s.shares[c.address] += difficulty
+	c.sharesCount++
+	address := c.address
+	solved := value < ShareTarget(j.blockDifficulty)
+	var taken map[string]float64
+	if solved {
+		// Retire the job so later shares and solutions on it are stale, and take
+		// the shares its coinbase pays out of the round before importing, so jobs
+		// rebuilt on the new tip don't pay them again. Shares accepted after the
+		// job was built, this one included, carry over to the next round.
+		delete(s.jobs, j.id)
+		taken = s.takeShares(j.paid)
+	}
+	s.mu.Unlock()
+
+	result := &Result{Accepted: true}
+	if solved {
+		if block, err := s.bc.SubmitBlock(j.id, int(params.Nonce)); err != nil {
+			s.log.Warn("Block solution rejected", "miner", address, "reason", err)
+			s.mu.Lock()
+			if s.job != nil && s.job.height == j.height {
+				for address, weight := range taken {
+					s.shares[address] += weight
+				}
+			}
+			s.mu.Unlock()
+		} else {
+			result.Block = true
+			s.log.Info("Block found", "height", block.Index, "miner", address, "paid", len(block.Rewards))
+		}
+	}
+	return Response{Result: result}
+}
+
+// takeShares removes the given weights from the round, as far as the round holds
+// them, and returns the amounts removed; s.mu must be held
+func (s *Server) takeShares(weights map[string]float64) map[string]float64 {
+	taken := make(map[string]float64, len(weights))
+	for address, weight := range weights {
+		amount := math.Min(weight, s.shares[address])
+		if amount <= 0 {
+			continue
+		}
+		taken[address] = amount
+		s.shares[address] -= amount
+		if s.shares[address] <= 1e-9 {
+			delete(s.shares, address)
+		}
+	}
+	return taken
+}
+
+// retargetAll adjusts the share difficulty of every miner towards one share per
+// TargetShareTime, changing it by at most 4x at a time
+func (s *Server) retargetAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for c := range s.clients {
+		if c.address == "" {
+			continue
+		}
+		elapsed := now.Sub(c.lastRetarget)
+		if elapsed < s.cfg.RetargetInterval {
+			continue
+		}
+		ratio := float64(c.sharesCount) * s.cfg.TargetShareTime.Seconds() / elapsed.Seconds()
+		if ratio < 0.25 {
+			ratio = 0.25
+		} else if ratio > 4 {
+			ratio = 4
+		}
+		difficulty := c.difficulty * ratio
+		if difficulty < s.cfg.MinDifficulty {
+			difficulty = s.cfg.MinDifficulty
+		}
+		if s.job != nil && difficulty > s.job.blockDifficulty {
+			difficulty = s.job.blockDifficulty
+		}
+		c.sharesCount = 0
+		c.lastRetarget = now
+		if difficulty == c.difficulty {
+			continue
+		}
+		s.log.Debug("Vardiff retarget", "miner", c.address, "from", c.difficulty, "to", difficulty)
+		c.difficulty = difficulty
+		s.sendJob(c)
+	}
+}
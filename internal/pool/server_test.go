@@ -0,0 +1,256 @@
+package pool
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+	"unknownberrytrip/internal/blockchain"
+	"unknownberrytrip/internal/logging"
+	"unknownberrytrip/internal/wallet"
+)
+
+type testMiner struct {
+	t       *testing.T
+	conn    net.Conn
+	scanner *bufio.Scanner
+	nextID  int
+	jobs    []Job // Job notifications read while waiting for responses
+}
+
+func dialMiner(t *testing.T, addr, payout string) (*testMiner, Job) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	m := &testMiner{t: t, conn: conn, scanner: bufio.NewScanner(conn)}
+	if resp := m.call("login", LoginParams{Address: payout}); resp.Error != "" {
+		t.Fatalf("Login failed: %s", resp.Error)
+	}
+	return m, m.read().Params
+}
+
+func (m *testMiner) read() Message {
+	m.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if !m.scanner.Scan() {
+		m.t.Fatalf("Read failed: %v", m.scanner.Err())
+	}
+	var msg Message
+	if err := json.Unmarshal(m.scanner.Bytes(), &msg); err != nil {
+		m.t.Fatalf("Invalid message: %v", err)
+	}
+	return msg
+}
+
+func (m *testMiner) call(method string, params interface{}) Message {
+	raw, _ := json.Marshal(params)
+	m.nextID++
+	json.NewEncoder(m.conn).Encode(Request{ID: m.nextID, Method: method, Params: raw})
+	for {
+		msg := m.read()
+		if msg.Method == "" {
+			return msg
+		}
+		m.jobs = append(m.jobs, msg.Params)
+	}
+}
+
+// jobAt returns the first job for height, waiting for it if it was not seen yet
+func (m *testMiner) jobAt(height int) Job {
+	for {
+		for _, job := range m.jobs {
+			if job.Height == height {
+				return job
+			}
+		}
+		if msg := m.read(); msg.Method == "job" {
+			m.jobs = append(m.jobs, msg.Params)
+		}
+	}
+}
+
+// findNonce returns the first nonce of the job range whose hash value is below target
+func findNonce(job Job, from uint64, target uint32) uint64 {
+	prefix, _ := hex.DecodeString(job.HeaderPrefix)
+	buf := make([]byte, len(prefix)+8)
+	copy(buf, prefix)
+	for nonce := from; ; nonce++ {
+		binary.BigEndian.PutUint64(buf[len(prefix):], nonce)
+		if HashValue(sha256.Sum256(buf)) < target {
+			return nonce
+		}
+	}
+}
+
+// findShare returns the first nonce from the given one that is a share but not a block
+func findShare(job Job, from uint64) uint64 {
+	for nonce := from; ; nonce++ {
+		nonce = findNonce(job, nonce, job.ShareTarget)
+		if findNonce(job, nonce, ShareTarget(job.BlockDifficulty)) != nonce {
+			return nonce
+		}
+	}
+}
+
+func TestPoolSharesAndPayouts(t *testing.T) {
+	bc := blockchain.NewBlockchain()
+	senderWallet := wallet.NewWallet()
+	bc.Balances[senderWallet.Address] = 10.0
+	tx := senderWallet.CreateTransaction("receiver", 1.0, 0)
+	if err := bc.AddTransactionToPool(*tx); err != nil {
+		t.Fatalf("AddTransactionToPool failed: %v", err)
+	}
+
+	cfg := DefaultConfig("127.0.0.1:0", "operator")
+	cfg.InitialDifficulty = 1
+	cfg.JobRefresh = time.Hour
+	cfg.RetargetInterval = time.Hour
+	s := NewServer(bc, cfg)
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer s.Close()
+
+	alice, aliceJob := dialMiner(t, s.Addr(), "alice")
+	defer alice.conn.Close()
+	bob, bobJob := dialMiner(t, s.Addr(), "bob")
+	defer bob.conn.Close()
+	if aliceJob.NonceStart == bobJob.NonceStart {
+		t.Fatal("Expected miners to get distinct nonce ranges")
+	}
+
+	t.Log("Submitting 3 shares for alice and 1 for bob")
+	nonce := aliceJob.NonceStart
+	for i := 0; i < 3; i++ {
+		nonce = findShare(aliceJob, nonce)
+		if resp := alice.call("submit", SubmitParams{JobID: aliceJob.JobID, Nonce: nonce}); resp.Error != "" {
+			t.Fatalf("Share rejected: %s", resp.Error)
+		}
+		nonce++
+	}
+	bobNonce := findShare(bobJob, bobJob.NonceStart)
+	if resp := bob.call("submit", SubmitParams{JobID: bobJob.JobID, Nonce: bobNonce}); resp.Error != "" {
+		t.Fatalf("Share rejected: %s", resp.Error)
+	}
+
+	if resp := bob.call("submit", SubmitParams{JobID: bobJob.JobID, Nonce: bobNonce}); resp.Error != "duplicate share" {
+		t.Errorf("Expected duplicate share, got %+v", resp)
+	}
+	if resp := bob.call("submit", SubmitParams{JobID: bobJob.JobID, Nonce: aliceJob.NonceStart}); resp.Error != "nonce out of range" {
+		t.Errorf("Expected nonce out of range, got %+v", resp)
+	}
+
+	t.Log("Refreshing the job so its coinbase pays the round")
+	s.refreshJob(false)
+	aliceJob = alice.read().Params
+	bob.read()
+
+	blockNonce := findNonce(aliceJob, aliceJob.NonceStart, ShareTarget(aliceJob.BlockDifficulty))
+	resp := alice.call("submit", SubmitParams{JobID: aliceJob.JobID, Nonce: blockNonce})
+	if resp.Error != "" || resp.Result == nil || !resp.Result.Block {
+		t.Fatalf("Expected block solution to be accepted, got %+v", resp)
+	}
+	reward := bc.Chain[1].Fees.Miner + bc.BlockReward(1)
+	if bc.Balances["alice"] != reward*0.75 || bc.Balances["bob"] != reward*0.25 {
+		t.Errorf("Expected 3:1 reward split, got alice %f bob %f", bc.Balances["alice"], bc.Balances["bob"])
+	}
+
+	if resp := bob.call("submit", SubmitParams{JobID: bobJob.JobID, Nonce: bobNonce + 1}); resp.Error != "stale share" {
+		t.Errorf("Expected stale share after the tip moved, got %+v", resp)
+	}
+}
+
+func TestPoolCarriesLateSharesToNextBlock(t *testing.T) {
+	params := blockchain.DefaultChainParams()
+	params.MaxBlockTxs = 1
+	bc := blockchain.NewBlockchainWithParams(params)
+	senderWallet := wallet.NewWallet()
+	bc.Balances[senderWallet.Address] = 10.0
+	for nonce := 0; nonce < 2; nonce++ {
+		if err := bc.AddTransactionToPool(*senderWallet.CreateTransaction("receiver", 1.0, nonce)); err != nil {
+			t.Fatalf("AddTransactionToPool failed: %v", err)
+		}
+	}
+
+	cfg := DefaultConfig("127.0.0.1:0", "operator")
+	cfg.InitialDifficulty = 1
+	cfg.JobRefresh = time.Hour
+	cfg.RetargetInterval = time.Hour
+	s := NewServer(bc, cfg)
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer s.Close()
+	alice, job := dialMiner(t, s.Addr(), "alice")
+	defer alice.conn.Close()
+
+	t.Log("Solving the first job, built before any share, after two shares")
+	nonce := job.NonceStart
+	for i := 0; i < 2; i++ {
+		nonce = findShare(job, nonce)
+		if resp := alice.call("submit", SubmitParams{JobID: job.JobID, Nonce: nonce}); resp.Error != "" {
+			t.Fatalf("Share rejected: %s", resp.Error)
+		}
+		nonce++
+	}
+	blockNonce := findNonce(job, nonce, ShareTarget(job.BlockDifficulty))
+	if resp := alice.call("submit", SubmitParams{JobID: job.JobID, Nonce: blockNonce}); resp.Result == nil || !resp.Result.Block {
+		t.Fatalf("Expected block solution to be accepted, got %+v", resp)
+	}
+	firstReward := bc.Chain[1].Fees.Miner + bc.BlockReward(1)
+	if bc.Balances["operator"] != firstReward || bc.Balances["alice"] != 0 {
+		t.Fatalf("Expected the first block to pay the operator, got operator %f alice %f", bc.Balances["operator"], bc.Balances["alice"])
+	}
+
+	t.Log("Solving the job on the new tip, which pays the carried shares")
+	job = alice.jobAt(2)
+	blockNonce = findNonce(job, job.NonceStart, ShareTarget(job.BlockDifficulty))
+	if resp := alice.call("submit", SubmitParams{JobID: job.JobID, Nonce: blockNonce}); resp.Result == nil || !resp.Result.Block {
+		t.Fatalf("Expected block solution to be accepted, got %+v", resp)
+	}
+	if secondReward := bc.Chain[2].Fees.Miner + bc.BlockReward(2); bc.Balances["alice"] != secondReward || bc.Balances["operator"] != firstReward {
+		t.Errorf("Expected alice to be paid block 2 for her late shares, got alice %f operator %f", bc.Balances["alice"], bc.Balances["operator"])
+	}
+}
+
+func TestPoolRejectsSecondSolutionOnSolvedJob(t *testing.T) {
+	bc := blockchain.NewBlockchain()
+	senderWallet := wallet.NewWallet()
+	bc.Balances[senderWallet.Address] = 10.0
+	if err := bc.AddTransactionToPool(*senderWallet.CreateTransaction("receiver", 1.0, 0)); err != nil {
+		t.Fatalf("AddTransactionToPool failed: %v", err)
+	}
+
+	// Without Start no job loop rebuilds jobs when the tip moves, so the second
+	// solution reaches the solved job like one arriving before the rebuild
+	cfg := DefaultConfig("127.0.0.1:0", "operator")
+	cfg.Logger = logging.Discard()
+	s := NewServer(bc, cfg)
+	alice := &client{address: "alice", difficulty: 1}
+	bob := &client{address: "bob", difficulty: 1, nonceStart: 1 << nonceRangeBits}
+	s.shares["alice"], s.shares["bob"] = 3, 1
+	s.refreshJob(true)
+	job := Job{JobID: s.job.id, HeaderPrefix: hex.EncodeToString(s.job.prefix)}
+	submit := func(c *client) Response {
+		nonce := findNonce(job, c.nonceStart, ShareTarget(s.job.blockDifficulty))
+		raw, _ := json.Marshal(SubmitParams{JobID: job.JobID, Nonce: nonce})
+		return s.submit(c, Request{Params: raw})
+	}
+
+	if resp := submit(alice); resp.Result == nil || !resp.Result.Block {
+		t.Fatalf("Expected the first solution to be accepted, got %+v", resp)
+	}
+	if resp := submit(bob); resp.Error != "stale share" {
+		t.Errorf("Expected a second solution on the solved job to be stale, got %+v", resp)
+	}
+	if len(s.shares) != 1 || s.shares["alice"] != 1 {
+		t.Errorf("Expected only the solving share of alice left in the round, got %v", s.shares)
+	}
+	if reward := bc.Chain[1].Fees.Miner + bc.BlockReward(1); bc.Balances["alice"] != reward*0.75 || bc.Balances["bob"] != reward*0.25 {
+		t.Errorf("Expected 3:1 reward split, got alice %f bob %f", bc.Balances["alice"], bc.Balances["bob"])
+	}
+}
@@ -1,15 +1,32 @@
 package transaction
 
 import (
+	"bytes"
 	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/sha256"
+	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
-	"fmt"
+	"math"
 	"math/big"
 	"unknownberrytrip/internal/utils"
 )
 
+// halfOrder is N/2 of the P-256 curve, the upper bound for canonical signatures
+var halfOrder = new(big.Int).Rsh(elliptic.P256().Params().N, 1)
+
+// TxType selects what a transaction does
+type TxType string
+
+const (
+	TxTransfer   TxType = ""           // Moves Amount of UNBT, or of TokenID, to To
+	TxStake      TxType = "stake"      // Locks Amount of UNBT to raise daily BasePower
+	TxUnstake    TxType = "unstake"    // Starts unbonding Amount of staked UNBT
+	TxDelegate   TxType = "delegate"   // Lends Amount of daily BasePower capacity to To
+	TxUndelegate TxType = "undelegate" // Revokes the delegation to To
+)
+
 type Transaction struct {
 	From            string  // Sender address
 	To              string  // Recipient address
@@ -18,13 +35,27 @@ type Transaction struct {
 	ExtraPower      int     // Processing priority
 	IsTokenTransfer bool    // Token transfer flag
 	TokenID         string  // Token ID (if IsTokenTransfer = true)
+	Type            TxType  `json:",omitempty"` // Transfer when empty
+	ExpiryHeight    int     `json:",omitempty"` // Height a delegation ends at, 0 for never
 	PubKey          string  // Sender's public key
 	Signature       string  // Signature
+	// Sponsored transactions name a fee payer charged the BasePower and UNBT fees,
+	// who signs the same digest as the sender
+	FeePayer          string `json:",omitempty"` // Fee payer address, empty when the sender pays
+	FeePayerPubKey    string `json:",omitempty"` // Fee payer's public key
+	FeePayerSignature string `json:",omitempty"` // Fee payer's signature
 }
 
-// VerifyTxSignature verifies the transaction signature
-func VerifyTxSignature(tx *Transaction) bool {
-	pubKey := utils.StringToPubKey(tx.PubKey)
+// Payer returns the address charged the fees of the transaction
+func (tx *Transaction) Payer() string {
+	if tx.FeePayer != "" {
+		return tx.FeePayer
+	}
+	return tx.From
+}
+
+// SigningHash returns the digest signed by the sender
+func (tx *Transaction) SigningHash() [32]byte {
 	txForSign := struct {
 		From            string
 		To              string
@@ -33,19 +64,103 @@ func VerifyTxSignature(tx *Transaction) bool {
 		ExtraPower      int
 		IsTokenTransfer bool
 		TokenID         string
-	}{tx.From, tx.To, tx.Amount, tx.Nonce, tx.ExtraPower, tx.IsTokenTransfer, tx.TokenID}
+		Type            TxType `json:",omitempty"`
+		ExpiryHeight    int    `json:",omitempty"`
+		FeePayer        string `json:",omitempty"`
+	}{tx.From, tx.To, tx.Amount, tx.Nonce, tx.ExtraPower, tx.IsTokenTransfer, tx.TokenID, tx.Type, tx.ExpiryHeight, tx.FeePayer}
 	data, _ := json.Marshal(txForSign)
-	hash := sha256.Sum256(data)
-	sigBytes, _ := hex.DecodeString(tx.Signature)
-	r := big.NewInt(0).SetBytes(sigBytes[:len(sigBytes)/2])
-	s := big.NewInt(0).SetBytes(sigBytes[len(sigBytes)/2:])
+	return sha256.Sum256(data)
+}
+
+// VerifyTxSignature verifies the sender signature and, for sponsored transactions,
+// the fee payer signature. Each public key must belong to the address it signs for.
+func VerifyTxSignature(tx *Transaction) bool {
+	hash := tx.SigningHash()
+	if !verifySignature(tx.From, tx.PubKey, tx.Signature, hash) {
+		return false
+	}
+	if tx.FeePayer == "" {
+		return tx.FeePayerPubKey == "" && tx.FeePayerSignature == ""
+	}
+	return verifySignature(tx.FeePayer, tx.FeePayerPubKey, tx.FeePayerSignature, hash)
+}
+
+// verifySignature checks that signature is a valid low-S signature of hash by the
+// key pubKeyHex, and that the key hashes to address. Key and signature must be in
+// their one canonical encoding, lowercase hex of the uncompressed key and of the
+// 32-byte r and s, since any other encoding of the same values would give the
+// transaction a second ID.
+func verifySignature(address, pubKeyHex, signature string, hash [32]byte) bool {
+	pubKey := utils.StringToPubKey(pubKeyHex)
+	if pubKey.X == nil || utils.PubKeyToString(pubKey) != pubKeyHex || utils.PubKeyToAddress(pubKey) != address {
+		return false
+	}
+	sigBytes, err := hex.DecodeString(signature)
+	if err != nil || len(sigBytes) != 64 || hex.EncodeToString(sigBytes) != signature {
+		return false
+	}
+	r := big.NewInt(0).SetBytes(sigBytes[:32])
+	s := big.NewInt(0).SetBytes(sigBytes[32:])
+	// Only the low-S form is accepted, otherwise (r, N-s) would give the same
+	// transaction a second ID
+	if s.Cmp(halfOrder) > 0 {
+		return false
+	}
 	return ecdsa.Verify(pubKey, hash[:], r, s)
 }
 
-// Hash computes the transaction hash
+// ID returns the transaction identifier: a SHA-256 over an unambiguous encoding of
+// every field, signature included. Strings are length-prefixed and the amount is
+// encoded by its exact bits, so distinct transactions never share an ID.
+func (tx *Transaction) ID() string {
+	var buf bytes.Buffer
+	writeString := func(v string) {
+		var n [binary.MaxVarintLen64]byte
+		buf.Write(n[:binary.PutUvarint(n[:], uint64(len(v)))])
+		buf.WriteString(v)
+	}
+	writeUint := func(v uint64) {
+		var n [8]byte
+		binary.BigEndian.PutUint64(n[:], v)
+		buf.Write(n[:])
+	}
+
+	writeString(tx.From)
+	writeString(tx.To)
+	writeUint(math.Float64bits(tx.Amount))
+	writeUint(uint64(tx.Nonce))
+	writeUint(uint64(tx.ExtraPower))
+	if tx.IsTokenTransfer {
+		buf.WriteByte(1)
+	} else {
+		buf.WriteByte(0)
+	}
+	writeString(tx.TokenID)
+	writeString(tx.PubKey)
+	writeString(tx.Signature)
+	// Optional fields are appended behind a tag only when set, so transfer IDs
+	// stay the same and the encoding remains unambiguous
+	if tx.Type != TxTransfer {
+		buf.WriteByte('t')
+		writeString(string(tx.Type))
+	}
+	if tx.ExpiryHeight != 0 {
+		buf.WriteByte('e')
+		writeUint(uint64(tx.ExpiryHeight))
+	}
+	if tx.FeePayer != "" {
+		buf.WriteByte('p')
+		writeString(tx.FeePayer)
+		writeString(tx.FeePayerPubKey)
+		writeString(tx.FeePayerSignature)
+	}
+	hash := sha256.Sum256(buf.Bytes())
+	return hex.EncodeToString(hash[:])
+}
+
+// Hash returns the transaction ID.
+//
+// Deprecated: use ID.
 func (tx *Transaction) Hash() string {
-	record := fmt.Sprintf("%s%s%f%d%d%t%s", tx.From, tx.To, tx.Amount, tx.Nonce, tx.ExtraPower, tx.IsTokenTransfer, tx.TokenID)
-	h := sha256.New()
-	h.Write([]byte(record))
-	return hex.EncodeToString(h.Sum(nil))
+	return tx.ID()
 }
@@ -0,0 +1,81 @@
+package transaction
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"unknownberrytrip/internal/utils"
+)
+
+func TestIDDistinguishesFieldBoundaries(t *testing.T) {
+	tx1 := Transaction{From: "ab", To: "c", Amount: 1.0}
+	tx2 := Transaction{From: "a", To: "bc", Amount: 1.0}
+	if tx1.ID() == tx2.ID() {
+		t.Error("Expected different IDs for shifted field boundaries")
+	}
+}
+
+func TestIDKeepsAmountPrecision(t *testing.T) {
+	tx1 := Transaction{From: "a", To: "b", Amount: 0.1234567}
+	tx2 := Transaction{From: "a", To: "b", Amount: 0.1234568}
+	if tx1.ID() == tx2.ID() {
+		t.Error("Expected different IDs for amounts differing below 1e-6")
+	}
+}
+
+func TestIDCoversSignature(t *testing.T) {
+	tx := Transaction{From: "a", To: "b", Amount: 1.0, Signature: "01"}
+	id := tx.ID()
+	tx.Signature = "02"
+	if tx.ID() == id {
+		t.Error("Expected ID to change with the signature")
+	}
+}
+
+// signedTx returns a transfer signed the way wallets sign it
+func signedTx(t *testing.T) *Transaction {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	tx := &Transaction{From: utils.PubKeyToAddress(&key.PublicKey), To: "b", Amount: 1.0, PubKey: utils.PubKeyToString(&key.PublicKey)}
+	hash := tx.SigningHash()
+	r, s, err := ecdsa.Sign(rand.Reader, key, hash[:])
+	if err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	if s.Cmp(halfOrder) > 0 {
+		s.Sub(elliptic.P256().Params().N, s)
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	tx.Signature = hex.EncodeToString(sig)
+	if !VerifyTxSignature(tx) {
+		t.Fatal("Expected the canonical signature to verify")
+	}
+	return tx
+}
+
+func TestNonCanonicalEncodingsDoNotVerify(t *testing.T) {
+	tx := signedTx(t)
+	half := len(tx.Signature) / 2
+	variants := map[string]func(tx *Transaction){
+		"zero-padded signature": func(tx *Transaction) {
+			tx.Signature = "00" + tx.Signature[:half] + "00" + tx.Signature[half:]
+		},
+		"uppercase signature":  func(tx *Transaction) { tx.Signature = strings.ToUpper(tx.Signature) },
+		"uppercase public key": func(tx *Transaction) { tx.PubKey = strings.ToUpper(tx.PubKey) },
+	}
+	for name, mutate := range variants {
+		variant := *tx
+		mutate(&variant)
+		if VerifyTxSignature(&variant) {
+			t.Errorf("Expected the %s to be rejected, it would change the ID from %s to %s", name, tx.ID(), variant.ID())
+		}
+	}
+}
@@ -3,6 +3,7 @@ package utils
 import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
+	"crypto/sha256"
 	"encoding/hex"
 )
 
@@ -17,3 +18,9 @@ func StringToPubKey(pubKeyStr string) *ecdsa.PublicKey {
 	x, y := elliptic.Unmarshal(elliptic.P256(), pubBytes)
 	return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
 }
+
+// PubKeyToAddress derives the address of a public key: SHA-256 of its uncompressed encoding
+func PubKeyToAddress(pubKey *ecdsa.PublicKey) string {
+	hash := sha256.Sum256(elliptic.Marshal(pubKey.Curve, pubKey.X, pubKey.Y))
+	return hex.EncodeToString(hash[:])
+}
@@ -4,9 +4,8 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
-	"crypto/sha256"
 	"encoding/hex"
-	"encoding/json"
+	"math/big"
 	"unknownberrytrip/internal/transaction"
 	"unknownberrytrip/internal/utils"
 )
@@ -27,33 +26,106 @@ func NewWallet() *Wallet {
 
 // PubKeyToAddress generates an address from a public key
 func PubKeyToAddress(pubKey *ecdsa.PublicKey) string {
-	pubBytes := elliptic.Marshal(pubKey.Curve, pubKey.X, pubKey.Y)
-	hash := sha256.Sum256(pubBytes)
-	return hex.EncodeToString(hash[:])
+	return utils.PubKeyToAddress(pubKey)
 }
 
-// SignTx signs a transaction
+// SignTx signs a transaction as its sender. A sponsored transaction must have
+// FeePayer set before signing.
 func (w *Wallet) SignTx(tx *transaction.Transaction) string {
-	txForSign := struct {
-		From   string
-		To     string
-		Amount float64
-		Nonce  int
-	}{tx.From, tx.To, tx.Amount, tx.Nonce}
-	data, _ := json.Marshal(txForSign)
-	hash := sha256.Sum256(data)
+	hash := tx.SigningHash()
 	r, s, _ := ecdsa.Sign(rand.Reader, w.PrivateKey, hash[:])
-	signature := append(r.Bytes(), s.Bytes()...)
+	// Normalize to low-S, the only form accepted by VerifyTxSignature
+	n := w.PrivateKey.Curve.Params().N
+	if s.Cmp(new(big.Int).Rsh(n, 1)) > 0 {
+		s.Sub(n, s)
+	}
+	// Fixed-width halves, so the verifier can split the signature in the middle
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
 	return hex.EncodeToString(signature)
 }
 
-// CreateTransaction creates and signs a transaction
+// SignAsFeePayer signs a sponsored transaction as its fee payer, agreeing to pay
+// its BasePower and UNBT fees. The wallet must be tx.FeePayer.
+func (w *Wallet) SignAsFeePayer(tx *transaction.Transaction) {
+	tx.FeePayerPubKey = utils.PubKeyToString(w.PublicKey)
+	tx.FeePayerSignature = w.SignTx(tx)
+}
+
+// CreateSponsoredTransaction creates and signs, as the sender, a transaction whose
+// fees are paid by feePayer, which still has to sign it with SignAsFeePayer
+func (w *Wallet) CreateSponsoredTransaction(to string, amount float64, nonce int, feePayer string) *transaction.Transaction {
+	tx := &transaction.Transaction{
+		From:     w.Address,
+		To:       to,
+		Amount:   amount,
+		Nonce:    nonce,
+		FeePayer: feePayer,
+		PubKey:   utils.PubKeyToString(w.PublicKey),
+	}
+	tx.Signature = w.SignTx(tx)
+	return tx
+}
+
+// CreateTransaction creates and signs a transaction with the given sender nonce
 func (w *Wallet) CreateTransaction(to string, amount float64, nonce int) *transaction.Transaction {
 	tx := &transaction.Transaction{
 		From:   w.Address,
 		To:     to,
 		Amount: amount,
-		Nonce:  nonce + 1,
+		Nonce:  nonce,
+		PubKey: utils.PubKeyToString(w.PublicKey),
+	}
+	tx.Signature = w.SignTx(tx)
+	return tx
+}
+
+// CreateStakeTransaction creates and signs a transaction locking amount of UNBT for BasePower
+func (w *Wallet) CreateStakeTransaction(amount float64, nonce int) *transaction.Transaction {
+	return w.createTypedTransaction(transaction.TxStake, amount, nonce)
+}
+
+// CreateUnstakeTransaction creates and signs a transaction unbonding amount of staked UNBT
+func (w *Wallet) CreateUnstakeTransaction(amount float64, nonce int) *transaction.Transaction {
+	return w.createTypedTransaction(transaction.TxUnstake, amount, nonce)
+}
+
+func (w *Wallet) createTypedTransaction(txType transaction.TxType, amount float64, nonce int) *transaction.Transaction {
+	tx := &transaction.Transaction{
+		From:   w.Address,
+		Amount: amount,
+		Nonce:  nonce,
+		Type:   txType,
+		PubKey: utils.PubKeyToString(w.PublicKey),
+	}
+	tx.Signature = w.SignTx(tx)
+	return tx
+}
+
+// CreateDelegateTransaction creates and signs a transaction lending amount of daily
+// BasePower capacity to another address until expiryHeight, 0 for no expiry
+func (w *Wallet) CreateDelegateTransaction(to string, amount, expiryHeight, nonce int) *transaction.Transaction {
+	tx := &transaction.Transaction{
+		From:         w.Address,
+		To:           to,
+		Amount:       float64(amount),
+		Nonce:        nonce,
+		Type:         transaction.TxDelegate,
+		ExpiryHeight: expiryHeight,
+		PubKey:       utils.PubKeyToString(w.PublicKey),
+	}
+	tx.Signature = w.SignTx(tx)
+	return tx
+}
+
+// CreateUndelegateTransaction creates and signs a transaction revoking the delegation to another address
+func (w *Wallet) CreateUndelegateTransaction(to string, nonce int) *transaction.Transaction {
+	tx := &transaction.Transaction{
+		From:   w.Address,
+		To:     to,
+		Nonce:  nonce,
+		Type:   transaction.TxUndelegate,
 		PubKey: utils.PubKeyToString(w.PublicKey),
 	}
 	tx.Signature = w.SignTx(tx)
@@ -1,6 +1,9 @@
 package wallet
 
-import "testing"
+import (
+	"testing"
+	"unknownberrytrip/internal/transaction"
+)
 
 func TestNewWallet(t *testing.T) {
 	w := NewWallet()
@@ -25,3 +28,38 @@ func TestCreateTransaction(t *testing.T) {
 		t.Error("Expected non-empty signature")
 	}
 }
+
+func TestSponsoredTransactionSignatures(t *testing.T) {
+	sender, payer := NewWallet(), NewWallet()
+	tx := sender.CreateSponsoredTransaction("someAddress", 1.0, 0, payer.Address)
+	if transaction.VerifyTxSignature(tx) {
+		t.Error("Expected a transaction without the fee payer signature to be invalid")
+	}
+	payer.SignAsFeePayer(tx)
+	if !transaction.VerifyTxSignature(tx) {
+		t.Fatal("Expected a transaction signed by sender and fee payer to be valid")
+	}
+
+	other := NewWallet()
+	forged := *tx
+	other.SignAsFeePayer(&forged)
+	if transaction.VerifyTxSignature(&forged) {
+		t.Error("Expected a fee payer key not matching FeePayer to be rejected")
+	}
+	changed := *tx
+	changed.FeePayer = other.Address
+	other.SignAsFeePayer(&changed)
+	if transaction.VerifyTxSignature(&changed) {
+		t.Error("Expected a fee payer swapped after the sender signed to be rejected")
+	}
+}
+
+func TestVerifyRejectsKeyOfAnotherAddress(t *testing.T) {
+	w := NewWallet()
+	tx := w.CreateTransaction("someAddress", 1.0, 0)
+	tx.From = NewWallet().Address
+	tx.Signature = w.SignTx(tx)
+	if transaction.VerifyTxSignature(tx) {
+		t.Error("Expected a signature by a key not owning From to be rejected")
+	}
+}